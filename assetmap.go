@@ -22,33 +22,52 @@ package dcp
 
 import (
 	"encoding/xml"
+	"errors"
+	"io"
 	"io/ioutil"
 	"regexp"
 	"time"
 )
 
+// AssetMap namespaces
+const (
+	interopAMNamespace = "http://www.digicine.com/PROTO-ASDCP-AM-20040311#"
+	smpteAMNamespace   = "http://www.smpte-ra.org/schemas/429-9/2007/AM"
+)
+
 // AssetMap is the struct produced by the parser
 type AssetMap struct {
-	Format      Format
-	ID          string
-	Creator     string
-	VolumeCount uint8
-	Issuer      string
-	IssueDate   time.Time
-	Assets      []*AMAsset
+	Format      Format     `json:"format"`
+	ID          string     `json:"id"`
+	Creator     string     `json:"creator"`
+	VolumeCount uint8      `json:"volumeCount"`
+	Issuer      string     `json:"issuer"`
+	IssueDate   time.Time  `json:"issueDate"`
+	Assets      []*AMAsset `json:"assets"`
 }
 
 // AMAsset is an asset map asset
 type AMAsset struct {
-	ID     string
-	Type   AssetType
-	Chunks []*Chunk
+	ID     string    `json:"id"`
+	Type   AssetType `json:"type"`
+	Chunks []*Chunk  `json:"chunks"`
 }
 
-// Chunk is a single file and a component of an asset
+// Chunk is a single file and a component of an asset; an asset split across
+// volumes has a chunk on each, starting at Offset bytes into the asset
 type Chunk struct {
-	Path string
-	Size uint64 `xml:"Length"`
+	Path        string `json:"path"`
+	VolumeIndex int    `xml:",omitempty" json:"volumeIndex,omitempty"` // 0 if not set, meaning 1
+	Offset      uint64 `xml:",omitempty" json:"offset,omitempty"`
+	Size        uint64 `xml:"Length" json:"size"`
+}
+
+// Volume returns the index of the volume holding the chunk, starting at 1
+func (c Chunk) Volume() int {
+	if c.VolumeIndex < 1 {
+		return 1
+	}
+	return c.VolumeIndex
 }
 
 // Size is the summed size of all the assets referenced by the asset map
@@ -60,6 +79,19 @@ func (am AssetMap) Size() uint64 {
 	return totalSize
 }
 
+// VolumeSize is the summed size of the chunks on a volume
+func (am AssetMap) VolumeSize(index int) uint64 {
+	var size uint64
+	for _, asset := range am.Assets {
+		for _, chunk := range asset.Chunks {
+			if chunk.Volume() == index {
+				size += chunk.Size
+			}
+		}
+	}
+	return size
+}
+
 // Paths returns all asset file paths
 func (am AssetMap) Paths() []string {
 	var paths []string
@@ -69,6 +101,16 @@ func (am AssetMap) Paths() []string {
 	return paths
 }
 
+// Asset returns the asset with the given ID, or nil if it isn't in the map
+func (am AssetMap) Asset(id string) *AMAsset {
+	for _, asset := range am.Assets {
+		if asset.ID == id {
+			return asset
+		}
+	}
+	return nil
+}
+
 // Paths returns all file paths of an asset
 func (a AMAsset) Paths() []string {
 	var paths []string
@@ -96,6 +138,15 @@ func ParseAssetMapFile(amFilename string) (*AssetMap, error) {
 	return ParseAssetMap(xmlStr)
 }
 
+// ParseAssetMapReader parses an asset map XML document read from r
+func ParseAssetMapReader(r io.Reader) (*AssetMap, error) {
+	xmlStr, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAssetMap(xmlStr)
+}
+
 // ParseAssetMap parses an asset map XML string
 func ParseAssetMap(xmlStr []byte) (*AssetMap, error) {
 	var amXML assetMapXML
@@ -110,6 +161,7 @@ Structure used to unmarshall the XML; used internally only - AssetMap struct
 is passed back by ParseAssetMap() & ParseAssetMapFile()
 */
 type assetMapXML struct {
+	XMLName     xml.Name
 	Xmlns       string `xml:"xmlns,attr"`
 	ID          string `xml:"Id"`
 	Creator     string
@@ -120,8 +172,8 @@ type assetMapXML struct {
 }
 
 type assetXML struct {
-	ID          string `xml:"Id"`
-	PackingList string
+	ID          string   `xml:"Id"`
+	PackingList string   `xml:",omitempty"`
 	Chunks      []*Chunk `xml:"ChunkList>Chunk"`
 }
 
@@ -134,9 +186,9 @@ func makeAssetMap(amXML assetMapXML) (*AssetMap, error) {
 		IssueDate:   amXML.IssueDate,
 		Issuer:      amXML.Issuer}
 	// Set the type
-	if amXML.Xmlns == "http://www.digicine.com/PROTO-ASDCP-AM-20040311#" {
+	if amXML.Xmlns == interopAMNamespace {
 		assetMap.Format = INTEROP
-	} else if amXML.Xmlns == "http://www.smpte-ra.org/schemas/429-9/2007/AM" {
+	} else if amXML.Xmlns == smpteAMNamespace {
 		assetMap.Format = SMPTE
 	}
 	// Convert the xml assets to Asset
@@ -147,6 +199,39 @@ func makeAssetMap(amXML assetMapXML) (*AssetMap, error) {
 	return assetMap, nil
 }
 
+// MarshalAssetMap produces the asset map's XML document; the namespace is
+// chosen from the asset map's Format
+func MarshalAssetMap(am *AssetMap) ([]byte, error) {
+	var assets []*assetXML
+	for _, asset := range am.Assets {
+		aXML := &assetXML{ID: asset.ID, Chunks: asset.Chunks}
+		if asset.Type == PKLAssetType {
+			aXML.PackingList = "true"
+		}
+		assets = append(assets, aXML)
+	}
+	var xmlns string
+	switch am.Format {
+	case INTEROP:
+		xmlns = interopAMNamespace
+	case SMPTE:
+		xmlns = smpteAMNamespace
+	default:
+		return nil, errors.New("Unable to marshal an assetmap of unknown format")
+	}
+	// Both formats share the element order Id, Creator, VolumeCount,
+	// IssueDate, Issuer; only the namespace differs
+	return marshalXML(&assetMapXML{
+		XMLName:     xml.Name{Local: "AssetMap"},
+		Xmlns:       xmlns,
+		ID:          am.ID,
+		Creator:     am.Creator,
+		VolumeCount: am.VolumeCount,
+		IssueDate:   am.IssueDate,
+		Issuer:      am.Issuer,
+		Assets:      assets})
+}
+
 // Regular expressions for guessing file type from the file name
 var cplRegExp = regexp.MustCompile(`(cpl|CPL)(.xml|.XML)$`)
 var pklRegExp = regexp.MustCompile(`(pkl|PKL)(.xml|.XML)$`)
@@ -16,6 +16,9 @@
 package dcp
 
 import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -261,3 +264,88 @@ func TestAMSoundAsset(t *testing.T) {
 		t.Errorf("Asset size is incorrect: %d != %d", asset.Chunks[0].Size, assetSize)
 	}
 }
+
+func TestAMAssetLookup(t *testing.T) {
+	assetmap := parseAM(t)
+	assetID := "urn:uuid:d65572db-2e09-4745-817d-a2881222e2db"
+	asset := assetmap.Asset(assetID)
+	if asset == nil || asset.ID != assetID {
+		t.Errorf("Asset lookup failed for %s", assetID)
+	}
+	if assetmap.Asset("urn:uuid:missing") != nil {
+		t.Errorf("Asset lookup should return nil for an unknown id")
+	}
+}
+
+func TestMarshalAssetMap(t *testing.T) {
+	for _, format := range []Format{INTEROP, SMPTE} {
+		assetmap := parseAM(t)
+		assetmap.Format = format
+		xmlStr, err := MarshalAssetMap(assetmap)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		assetmap2, err := ParseAssetMap(xmlStr)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if assetmap2.Format != format {
+			t.Errorf("Format is incorrect: %d != %d", assetmap2.Format, format)
+		}
+		if assetmap2.Creator != assetmap.Creator || assetmap2.Issuer != assetmap.Issuer {
+			t.Errorf("Creator or Issuer is incorrect: %s, %s",
+				assetmap2.Creator, assetmap2.Issuer)
+		}
+		if assetmap2.Size() != assetmap.Size() {
+			t.Errorf("Size is incorrect: %d != %d", assetmap2.Size(), assetmap.Size())
+		}
+		for i, asset := range assetmap2.Assets {
+			if asset.Type != assetmap.Assets[i].Type {
+				t.Errorf("Asset type is incorrect: %d != %d",
+					asset.Type, assetmap.Assets[i].Type)
+			}
+		}
+	}
+}
+
+// Returns the names of the root element's children in document order
+func childElements(t *testing.T, xmlStr []byte) []string {
+	var names []string
+	depth := 0
+	decoder := xml.NewDecoder(bytes.NewReader(xmlStr))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				names = append(names, elem.Name.Local)
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if len(names) == 0 {
+		t.Fatalf("No elements found in %s", xmlStr)
+	}
+	return names
+}
+
+func TestMarshalAssetMapOrder(t *testing.T) {
+	expected := childElements(t, testAssetMapXML)
+	for _, format := range []Format{INTEROP, SMPTE} {
+		assetmap := parseAM(t)
+		assetmap.Format = format
+		xmlStr, err := MarshalAssetMap(assetmap)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if names := childElements(t, xmlStr); !reflect.DeepEqual(names, expected) {
+			t.Errorf("Element order is incorrect for format %d: %v != %v",
+				format, names, expected)
+		}
+	}
+}
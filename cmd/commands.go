@@ -0,0 +1,627 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+The dcp tool's subcommands; each builds its results, which are written as
+text or, with -json, as JSON
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/googlesamples/dcp"
+)
+
+/*
+validate loads the DCP at path, which is a directory or a tar archive;
+archives have every hash checked as they're read, which hashed reports
+*/
+func validate(d *dcp.DCP, path string) (report *dcp.Report, hashed bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return d.Validate(path), false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		report = &dcp.Report{}
+		report.Add(dcp.SeverityError, dcp.CodeArchiveInvalid, path, "", err.Error())
+		return report, false
+	}
+	defer file.Close()
+	return d.ValidateTar(file), true
+}
+
+/*
+loadDCP builds a DCP from a directory or tar archive, writing the problems
+found to stderr; the DCP is nil if its asset map couldn't be read, and the
+exit status reflects the worst problem
+*/
+func loadDCP(path string) (*dcp.DCP, int) {
+	d := &dcp.DCP{}
+	report, _ := validate(d, path)
+	for _, f := range report.Findings {
+		fmt.Fprintf(stderr, "dcp: %s: %s\n", f.Severity, f.Error())
+	}
+	if d.AssetMap == nil {
+		return nil, exitError
+	}
+	return d, exitStatus(report.MaxSeverity())
+}
+
+// worst returns the more severe of two exit statuses
+func worst(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// exitStatus maps the worst severity found to the exit status
+func exitStatus(severity dcp.Severity) int {
+	switch severity {
+	case dcp.SeverityError:
+		return exitError
+	case dcp.SeverityWarning:
+		return exitWarning
+	}
+	return exitOK
+}
+
+// writeJSON writes a command's results as indented JSON
+func writeJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s\n", data)
+	return err
+}
+
+// info is the summary printed by the info command
+type info struct {
+	Format   dcp.Format `json:"format"`
+	AssetMap string     `json:"assetMap"`
+	Size     uint64     `json:"size"`
+	CPLs     []*cplInfo `json:"cpls"`
+	PKLs     []string   `json:"pkls"`
+	Essences []*essence `json:"essences"`
+}
+
+type cplInfo struct {
+	ID        string       `json:"id"`
+	Title     string       `json:"title"`
+	Reels     int          `json:"reels"`
+	Encrypted bool         `json:"encrypted"`
+	EditRate  dcp.EditRate `json:"editRate"`
+	Duration  string       `json:"duration"` // timecode, HH:MM:SS:FF
+}
+
+// newCPLInfo summarizes a CPL
+func newCPLInfo(cpl *dcp.CPL) *cplInfo {
+	return &cplInfo{cpl.ID, cpl.ContentTitleText, len(cpl.Reels), cpl.IsEncrypted(),
+		cpl.EditRate(), cpl.EditRate().Timecode(cpl.Units())}
+}
+
+type essence struct {
+	Type        dcp.AssetType `json:"type"`
+	Path        string        `json:"path"`
+	Description string        `json:"description,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+var infoCommand = &command{
+	args:    "<dcp root dir or tar>",
+	nargs:   1,
+	summary: "print a summary of a DCP's compositions and essence",
+	run: func(args []string) (int, error) {
+		d, status := loadDCP(args[0])
+		if d == nil {
+			return status, nil
+		}
+		out := &info{Format: d.Format(), AssetMap: d.AssetMap.ID, Size: d.AssetMap.Size()}
+		for _, cpl := range d.CPLs {
+			out.CPLs = append(out.CPLs, newCPLInfo(cpl))
+		}
+		for _, pkl := range d.PKLs {
+			out.PKLs = append(out.PKLs, pkl.AnnotationText)
+		}
+		for _, e := range d.Essences() {
+			es := &essence{Type: e.Type, Path: e.Path}
+			if e.Err != nil {
+				es.Error = e.Err.Error()
+			} else {
+				es.Description = e.String()
+			}
+			out.Essences = append(out.Essences, es)
+		}
+		if jsonOutput {
+			return status, writeJSON(out)
+		}
+		fmt.Fprintf(stdout, "Format: %s\n", out.Format)
+		fmt.Fprintf(stdout, "AssetMap: %s\n", out.AssetMap)
+		fmt.Fprintf(stdout, "Size: %d\n", out.Size)
+		for _, cpl := range out.CPLs {
+			fmt.Fprintf(stdout, "CPL: %s\n", cpl.Title)
+			fmt.Fprintf(stdout, "  Id: %s\n", cpl.ID)
+			fmt.Fprintf(stdout, "  Reels: %d\n", cpl.Reels)
+			fmt.Fprintf(stdout, "  Duration: %s (%s)\n", cpl.Duration, cpl.EditRate)
+			fmt.Fprintf(stdout, "  Encrypted: %t\n", cpl.Encrypted)
+		}
+		for _, pkl := range out.PKLs {
+			fmt.Fprintf(stdout, "PKL: %s\n", pkl)
+		}
+		for _, e := range out.Essences {
+			fmt.Fprintf(stdout, "%s: %s %s%s\n", e.Type, e.Path, e.Description, e.Error)
+		}
+		return status, nil
+	},
+}
+
+// verifyHashes is set by the verify command's -hash flag
+var verifyHashes bool
+
+// verifyOVs are the OVs given by the verify command's -ov flags
+var verifyOVs paths
+
+// paths is a flag that can be given more than once
+type paths []string
+
+func (p *paths) String() string { return strings.Join(*p, ",") }
+
+func (p *paths) Set(path string) error {
+	*p = append(*p, path)
+	return nil
+}
+
+var verifyCommand = &command{
+	args:    "<dcp root dir or tar>",
+	nargs:   1,
+	summary: "check a DCP for problems, listing every finding",
+	flags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&verifyHashes, "hash", true, "check the hash of every asset")
+		fs.Var(&verifyOVs, "ov", "OV holding the assets of a VF; may be given more than once")
+	},
+	run: func(args []string) (int, error) {
+		d := &dcp.DCP{VF: len(verifyOVs) > 0}
+		report, hashed := validate(d, args[0])
+		if verifyHashes && !hashed && d.AssetMap != nil {
+			dcp.CheckHashes(d, report)
+		}
+		if len(verifyOVs) > 0 && d.AssetMap != nil {
+			var ovs []*dcp.DCP
+			for _, path := range verifyOVs {
+				ov := &dcp.DCP{}
+				if ovReport, _ := validate(ov, path); ov.AssetMap == nil {
+					return exitError, fmt.Errorf("OV %s: %s", path, ovReport.Err())
+				}
+				ovs = append(ovs, ov)
+			}
+			dcp.CheckVF(d, ovs, report)
+		}
+		status := exitStatus(report.MaxSeverity())
+		if jsonOutput {
+			return status, writeJSON(report)
+		}
+		for _, f := range report.Findings {
+			fmt.Fprintf(stdout, "%s\t%s\t%s\n", f.Severity, f.Code, f.Error())
+		}
+		return status, nil
+	},
+}
+
+// hash is the outcome of checking one asset's hash
+type hash struct {
+	OK       bool   `json:"ok"`
+	AssetID  string `json:"assetId"`
+	Path     string `json:"path,omitempty"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Message  string `json:"message"`
+}
+
+var hashCommand = &command{
+	args:    "<dcp root dir or tar>",
+	nargs:   1,
+	summary: "check every asset against the hash in its PKL",
+	run: func(args []string) (int, error) {
+		d, status := loadDCP(args[0])
+		if d == nil {
+			return status, nil
+		}
+		var out []*hash
+		for _, result := range d.VerifyHashes() {
+			if !result.OK() {
+				status = exitError
+			}
+			out = append(out, &hash{result.OK(), result.AssetID, result.Path,
+				result.Expected, result.Actual, result.Message()})
+		}
+		if jsonOutput {
+			return status, writeJSON(out)
+		}
+		for _, h := range out {
+			if h.OK {
+				fmt.Fprintf(stdout, "OK\t%s\n", h.Path)
+				continue
+			}
+			path := h.Path
+			if path == "" {
+				path = h.AssetID
+			}
+			fmt.Fprintf(stdout, "FAIL\t%s\t%s\n", path, h.Message)
+		}
+		return status, nil
+	},
+}
+
+// file is a file listed by the ls command
+type file struct {
+	Type dcp.AssetType `json:"type"`
+	Size uint64        `json:"size"`
+	Path string        `json:"path"`
+}
+
+var lsCommand = &command{
+	args:    "<dcp root dir or tar>",
+	nargs:   1,
+	summary: "list the files of a DCP with their type and size",
+	run: func(args []string) (int, error) {
+		d, status := loadDCP(args[0])
+		if d == nil {
+			return status, nil
+		}
+		var out []*file
+		for _, asset := range d.AssetMap.Assets {
+			for _, chunk := range asset.Chunks {
+				out = append(out, &file{assetType(d, asset), chunk.Size, chunk.Path})
+			}
+		}
+		if jsonOutput {
+			return status, writeJSON(out)
+		}
+		w := tabwriter.NewWriter(stdout, 0, 8, 1, ' ', 0)
+		for _, f := range out {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", f.Type, f.Size, f.Path)
+		}
+		return status, w.Flush()
+	},
+}
+
+// assetType is the type of an asset, from the PKL if it's listed there
+func assetType(d *dcp.DCP, asset *dcp.AMAsset) dcp.AssetType {
+	for _, pkl := range d.PKLs {
+		for _, pklAsset := range pkl.Assets {
+			if pklAsset.ID == asset.ID && pklAsset.Type != dcp.UnknownAssetType {
+				return pklAsset.Type
+			}
+		}
+	}
+	return asset.Type
+}
+
+// treeCPL, treeReel, treeAsset and treeMarker make up the tree command's
+// output
+type treeCPL struct {
+	ID    string      `json:"id"`
+	Title string      `json:"title"`
+	Reels []*treeReel `json:"reels"`
+}
+
+type treeReel struct {
+	ID      string        `json:"id"`
+	Assets  []*treeAsset  `json:"assets"`
+	Markers []*treeMarker `json:"markers,omitempty"`
+}
+
+type treeAsset struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	Path string `json:"path,omitempty"` // empty if it isn't in the asset map
+}
+
+type treeMarker struct {
+	Label    dcp.MarkerLabel `json:"label"`
+	Timecode string          `json:"timecode"` // from the start of the composition
+}
+
+var treeCommand = &command{
+	args:    "<dcp root dir or tar>",
+	nargs:   1,
+	summary: "print the compositions of a DCP, their reels and assets",
+	run: func(args []string) (int, error) {
+		d, status := loadDCP(args[0])
+		if d == nil {
+			return status, nil
+		}
+		paths := map[string]string{}
+		for _, asset := range d.AssetMap.Assets {
+			paths[asset.ID] = strings.Join(asset.Paths(), ", ")
+		}
+		var out []*treeCPL
+		for _, cpl := range d.CPLs {
+			tc := &treeCPL{ID: cpl.ID, Title: cpl.ContentTitleText}
+			markers := map[string][]*treeMarker{}
+			for _, m := range cpl.Markers() {
+				markers[m.ReelID] = append(markers[m.ReelID],
+					&treeMarker{m.Label, cpl.EditRate().Timecode(m.Position)})
+			}
+			for _, reel := range cpl.Reels {
+				tr := &treeReel{ID: reel.ID, Markers: markers[reel.ID]}
+				add := func(kind string, asset *dcp.Asset) {
+					tr.Assets = append(tr.Assets, &treeAsset{kind, asset.ID, paths[asset.ID]})
+				}
+				if reel.Picture != nil {
+					add("picture", &reel.Picture.Asset)
+				}
+				if reel.StereoscopicPicture != nil {
+					add("picture-3d", &reel.StereoscopicPicture.Asset)
+				}
+				if reel.Sound != nil {
+					add("sound", &reel.Sound.Asset)
+				}
+				if reel.Subtitle != nil {
+					add("subtitle", &reel.Subtitle.Asset)
+				}
+				tc.Reels = append(tc.Reels, tr)
+			}
+			out = append(out, tc)
+		}
+		if jsonOutput {
+			return status, writeJSON(out)
+		}
+		for _, tc := range out {
+			fmt.Fprintf(stdout, "CPL %s %s\n", tc.ID, tc.Title)
+			for i, tr := range tc.Reels {
+				fmt.Fprintf(stdout, "  Reel %d %s\n", i+1, tr.ID)
+				for _, ta := range tr.Assets {
+					path := ta.Path
+					if path == "" {
+						path = "(not in assetmap)"
+					}
+					fmt.Fprintf(stdout, "    %s %s %s\n", ta.Kind, ta.ID, path)
+				}
+				for _, tm := range tr.Markers {
+					fmt.Fprintf(stdout, "    marker %s %s\n", tm.Label, tm.Timecode)
+				}
+			}
+		}
+		return status, nil
+	},
+}
+
+// change is a difference found by the diff command: + for an added asset,
+// - for a removed one and ~ for a changed one
+type change struct {
+	Change string `json:"change"`
+	ID     string `json:"id"`
+	Path   string `json:"path"`
+}
+
+var diffCommand = &command{
+	args:    "<dcp root dir or tar> <dcp root dir or tar>",
+	nargs:   2,
+	summary: "compare the assets of two DCPs by ID, size and hash",
+	run: func(args []string) (int, error) {
+		a, statusA := loadDCP(args[0])
+		b, statusB := loadDCP(args[1])
+		status := worst(statusA, statusB)
+		if a == nil || b == nil {
+			return status, nil
+		}
+		assetsA, assetsB := diffAssets(a), diffAssets(b)
+		var ids []string
+		for id := range assetsA {
+			ids = append(ids, id)
+		}
+		for id := range assetsB {
+			if _, ok := assetsA[id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		var out []*change
+		for _, id := range ids {
+			assetA, inA := assetsA[id]
+			assetB, inB := assetsB[id]
+			switch {
+			case !inB:
+				out = append(out, &change{"-", id, assetA.path})
+			case !inA:
+				out = append(out, &change{"+", id, assetB.path})
+			case assetA.size != assetB.size || assetA.hash != assetB.hash:
+				out = append(out, &change{"~", id, assetB.path})
+			}
+		}
+		if len(out) > 0 {
+			status = worst(status, exitWarning)
+		}
+		if jsonOutput {
+			return status, writeJSON(out)
+		}
+		for _, c := range out {
+			fmt.Fprintf(stdout, "%s\t%s\t%s\n", c.Change, c.ID, c.Path)
+		}
+		return status, nil
+	},
+}
+
+// diffAsset is what's compared between the assets of two DCPs
+type diffAsset struct {
+	path string
+	size uint64
+	hash string
+}
+
+// diffAssets collects the assets of a DCP by ID
+func diffAssets(d *dcp.DCP) map[string]diffAsset {
+	assets := map[string]diffAsset{}
+	for _, asset := range d.AssetMap.Assets {
+		assets[asset.ID] = diffAsset{strings.Join(asset.Paths(), ", "), asset.Size(), ""}
+	}
+	for _, pkl := range d.PKLs {
+		for _, pklAsset := range pkl.Assets {
+			asset := assets[pklAsset.ID]
+			asset.hash = pklAsset.Hash
+			assets[pklAsset.ID] = asset
+		}
+	}
+	return assets
+}
+
+var jsonCommand = &command{
+	args:    "<dcp root dir or tar>",
+	nargs:   1,
+	summary: "print a DCP's asset map, CPLs and PKLs as JSON",
+	run: func(args []string) (int, error) {
+		d, status := loadDCP(args[0])
+		if d == nil {
+			return status, nil
+		}
+		return status, writeJSON(d)
+	},
+}
+
+// splitSize is set by the split command's -size flag
+var splitSize = "500G"
+
+// volume is a volume written by the split command
+type volume struct {
+	Index int    `json:"index"`
+	Dir   string `json:"dir"`
+	Size  uint64 `json:"size"`
+}
+
+var splitCommand = &command{
+	args:    "<dcp root dir> <output dir>",
+	nargs:   2,
+	summary: "split a DCP across volumes of a fixed size",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&splitSize, "size", splitSize,
+			"capacity of each volume in bytes, or with a K, M, G or T suffix (powers of 1000)")
+	},
+	run: func(args []string) (int, error) {
+		capacity, err := parseSize(splitSize)
+		if err != nil {
+			return exitError, err
+		}
+		d, status := loadDCP(args[0])
+		if d == nil {
+			return status, nil
+		}
+		am, err := d.PlanVolumes(capacity)
+		if err != nil {
+			return exitError, err
+		}
+		var out []*volume
+		var dirs []string
+		for i := 1; i <= int(am.VolumeCount); i++ {
+			dir := filepath.Join(args[1], fmt.Sprintf("VOL%d", i))
+			dirs = append(dirs, dir)
+			out = append(out, &volume{i, dir, am.VolumeSize(i)})
+		}
+		if err := d.WriteVolumes(am, dirs...); err != nil {
+			return exitError, err
+		}
+		if jsonOutput {
+			return status, writeJSON(out)
+		}
+		for _, v := range out {
+			fmt.Fprintf(stdout, "%d\t%d\t%s\n", v.Index, v.Size, v.Dir)
+		}
+		return status, nil
+	},
+}
+
+// parseSize parses a size in bytes, which may have a K, M, G or T suffix
+func parseSize(s string) (uint64, error) {
+	digits, multiplier := s, uint64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", strings.ToUpper(s)[n-1]); i >= 0 {
+			for ; i >= 0; i-- {
+				multiplier *= 1000
+			}
+			digits = s[:n-1]
+		}
+	}
+	size, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || size == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size * multiplier, nil
+}
+
+// scanWorkers is set by the scan command's -workers flag
+var scanWorkers int
+
+// libraryDCP is a DCP listed by the scan command
+type libraryDCP struct {
+	Dir      string     `json:"dir"`
+	Severity string     `json:"severity"` // worst finding, or "ok"
+	Findings int        `json:"findings"`
+	CPLs     []*cplInfo `json:"cpls"`
+}
+
+var scanCommand = &command{
+	args:    "<library root dir>",
+	nargs:   1,
+	summary: "find and check every DCP under a directory",
+	flags: func(fs *flag.FlagSet) {
+		fs.IntVar(&scanWorkers, "workers", 0, "DCPs loaded at once; 0 for one per CPU")
+	},
+	run: func(args []string) (int, error) {
+		lib, err := dcp.ScanLibrary(args[0], scanWorkers)
+		if err != nil {
+			return exitError, err
+		}
+		status := exitOK
+		var out []*libraryDCP
+		for _, entry := range lib.Entries {
+			severity := entry.Report.MaxSeverity()
+			status = worst(status, exitStatus(severity))
+			l := &libraryDCP{Dir: entry.Dir, Severity: "ok", Findings: len(entry.Report.Findings)}
+			if severity > dcp.SeverityInfo {
+				l.Severity = severity.String()
+			}
+			if entry.DCP != nil {
+				for _, cpl := range entry.DCP.CPLs {
+					l.CPLs = append(l.CPLs, newCPLInfo(cpl))
+				}
+			}
+			out = append(out, l)
+		}
+		if jsonOutput {
+			return status, writeJSON(out)
+		}
+		w := tabwriter.NewWriter(stdout, 0, 8, 1, ' ', 0)
+		for _, l := range out {
+			var titles []string
+			for _, cpl := range l.CPLs {
+				titles = append(titles, cpl.Title)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", l.Severity, l.Dir, strings.Join(titles, ", "))
+		}
+		return status, w.Flush()
+	},
+}
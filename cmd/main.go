@@ -13,28 +13,120 @@
 //    See the License for the specific language governing permissions and
 //    limitations under the License.
 
+/*
+dcp is a command line tool for inspecting and verifying DCPs; results are
+written to stdout and problems running a command to stderr
+
+The exit status is 0 if the DCP is fine, 1 if there are warnings and 2 if
+there are errors or the command couldn't be run
+*/
+
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"sort"
+)
+
+// Exit statuses
+const (
+	exitOK      = 0
+	exitWarning = 1
+	exitError   = 2
+)
 
-	"github.com/googlesamples/dcp"
+// Output streams, which -q discards stdout from
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
 )
 
-func testDCP() {
-	if len(os.Args) != 2 {
-		fmt.Fprintln(os.Stderr, "Usage: dcp <dcp root dir>")
-		return
+// jsonOutput is set by the -json flag common to all commands
+var jsonOutput bool
+
+// command is a subcommand of the tool
+type command struct {
+	args    string // positional arguments, for the usage message
+	nargs   int
+	summary string
+	flags   func(fs *flag.FlagSet)
+	run     func(args []string) (int, error) // exit status, error writing output
+}
+
+// commands maps each subcommand's name to its command
+var commands = map[string]*command{
+	"info":   infoCommand,
+	"verify": verifyCommand,
+	"hash":   hashCommand,
+	"ls":     lsCommand,
+	"tree":   treeCommand,
+	"diff":   diffCommand,
+	"json":   jsonCommand,
+	"split":  splitCommand,
+	"scan":   scanCommand,
+}
+
+// usage prints the list of subcommands
+func usage() {
+	fmt.Fprintln(stderr, "Usage: dcp <command> [flags] <dcp root dir or tar>...")
+	fmt.Fprintln(stderr, "\nCommands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
 	}
-	dcp := &dcp.DCP{}
-	if err := dcp.Generate(os.Args[1]); err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Println(dcp)
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stderr, "  %-8s %s\n", name, commands[name].summary)
 	}
+	fmt.Fprintln(stderr, "\nRun 'dcp <command> -h' for a command's flags")
+}
+
+// runCommand parses the flags of a subcommand and runs it
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "dcp: unknown command %q\n", name)
+		usage()
+		return exitError
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	quiet := fs.Bool("q", false, "write nothing to stdout, only set the exit status")
+	fs.BoolVar(&jsonOutput, "json", false, "write the results as JSON")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: dcp %s [flags] %s\n\n%s\n\nFlags:\n",
+			name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != cmd.nargs {
+		fs.Usage()
+		return exitError
+	}
+	if *quiet {
+		stdout = ioutil.Discard
+	}
+	status, err := cmd.run(fs.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "dcp: %s\n", err)
+		return exitError
+	}
+	return status
 }
 
 func main() {
-	testDCP()
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitError)
+	}
+	os.Exit(runCommand(os.Args[1], os.Args[2:]))
 }
@@ -22,80 +22,256 @@ package dcp
 
 import (
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"strings"
 	"time"
 )
 
 // ContentKind is the type of content referenced by a CPL
 type ContentKind int
 
+// Content kinds, from SMPTE ST 429-7 and the ISDCF list
 const (
-	unkownCPLKind ContentKind = iota
-	testCPLKind
-	featureCPLKind
-	advertisementCPLKind
+	ContentKindUnknown ContentKind = iota
+	ContentKindTest
+	ContentKindFeature
+	ContentKindAdvertisement
+	ContentKindTrailer
+	ContentKindTeaser
+	ContentKindRating
+	ContentKindTransitional
+	ContentKindShort
+	ContentKindPolicy
+	ContentKindPSA
+	ContentKindEpisode
+	ContentKindHighlights
+	ContentKindEvent
+	ContentKindPromo
+	ContentKindClip
+	ContentKindStereocard
+)
+
+// contentKindNames are the kinds as they're written in a CPL, indexed by
+// ContentKind
+var contentKindNames = []string{
+	"unknown",
+	"test",
+	"feature",
+	"advertisement",
+	"trailer",
+	"teaser",
+	"rating",
+	"transitional",
+	"short",
+	"policy",
+	"psa",
+	"episode",
+	"highlights",
+	"event",
+	"promo",
+	"clip",
+	"stereocard",
+}
+
+// smpteContentKindScope is the scope of the standard content kinds, which
+// applies when a ContentKind has no scope attribute
+const smpteContentKindScope = "http://www.smpte-ra.org/schemas/429-7/2006/CPL#content-kind"
+
+// ParseContentKind returns the content kind written as text, in any case, or
+// ContentKindUnknown
+func ParseContentKind(text string) ContentKind {
+	text = strings.TrimSpace(text)
+	for i, name := range contentKindNames {
+		if strings.EqualFold(name, text) {
+			return ContentKind(i)
+		}
+	}
+	return ContentKindUnknown
+}
+
+// String returns the kind as it's written in a CPL, or "unknown"
+func (kind ContentKind) String() string {
+	if kind < 0 || int(kind) >= len(contentKindNames) {
+		return contentKindNames[ContentKindUnknown]
+	}
+	return contentKindNames[kind]
+}
+
+// MarshalText renders the kind as it's written in a CPL
+func (kind ContentKind) MarshalText() ([]byte, error) {
+	return []byte(kind.String()), nil
+}
+
+// UnmarshalText reads a kind rendered by MarshalText; text that isn't a
+// known kind is an error
+func (kind *ContentKind) UnmarshalText(text []byte) error {
+	*kind = ParseContentKind(string(text))
+	if *kind == ContentKindUnknown && !strings.EqualFold(string(text), kind.String()) {
+		return fmt.Errorf("Unknown content kind: %s", text)
+	}
+	return nil
+}
+
+// CPL namespaces
+const (
+	interopCPLNamespace = "http://www.digicine.com/PROTO-ASDCP-CPL-20040511#"
+	smpteCPLNamespace   = "http://www.smpte-ra.org/schemas/429-7/2006/CPL"
+)
+
+// Stereoscopic picture namespaces, of the MainStereoscopicPicture element
+const (
+	interopStereoNamespace = "http://www.digicine.com/schemas/437-Y/2007/Main-Stereo-Picture-CPL"
+	smpteStereoNamespace   = "http://www.smpte-ra.org/schemas/429-10/2008/Main-Stereo-Picture-CPL"
 )
 
 // CPL struct is returned by the parser
 type CPL struct {
-	Format           Format
-	ID               string
-	AnnotationText   string
-	Creator          string
-	ContentTitleText string
-	IssueDate        time.Time
-	ContentKind      ContentKind
-	Reels            []*Reel
+	Format           Format      `json:"format"`
+	ID               string      `json:"id"`
+	AnnotationText   string      `json:"annotationText"`
+	Creator          string      `json:"creator"`
+	ContentTitleText string      `json:"contentTitleText"`
+	IssueDate        time.Time   `json:"issueDate"`
+	ContentKind      ContentKind `json:"contentKind"`
+	ContentKindScope string      `json:"contentKindScope,omitempty"` // SMPTE scope attribute, if any
+	ContentKindText  string      `json:"contentKindText,omitempty"`  // kind outside the standard list
+	Reels            []*Reel     `json:"reels"`
+	Signer           *Signer     `json:"signer,omitempty"` // nil if the CPL is unsigned
+
+	raw []byte // XML document the CPL was parsed from
 }
 
 // Asset is a CPL asset
 type Asset struct {
-	ID                string `xml:"Id"`
-	AnnotationText    string
-	EditRate          string
-	IntrinsicDuration uint64
-	EntryPoint        uint64
-	Duration          uint64
+	ID                string   `xml:"Id" json:"id"`
+	AnnotationText    string   `xml:",omitempty" json:"annotationText,omitempty"`
+	EditRate          EditRate `json:"editRate"`
+	IntrinsicDuration uint64   `json:"intrinsicDuration"`
+	EntryPoint        uint64   `json:"entryPoint"`
+	Duration          uint64   `xml:",omitempty" json:"duration"`
+	KeyID             string   `xml:"KeyId,omitempty" json:"keyId,omitempty"` // set if the asset is encrypted
+	Hash              string   `xml:",omitempty" json:"hash,omitempty"`       // Base64 SHA-1, as in the PKL
 }
 
 // Picture is a specific form of a CPL asset
 type Picture struct {
 	Asset
-	FrameRate         string
-	ScreenAspectRatio string
+	FrameRate         EditRate `json:"frameRate"`
+	ScreenAspectRatio string   `json:"screenAspectRatio"`
+}
+
+/*
+StereoscopicPicture is a 3D picture asset, from a MainStereoscopicPicture
+element in its own namespace; each edit unit holds an image per eye, so
+FrameRate is twice EditRate
+*/
+type StereoscopicPicture struct {
+	Picture
+	namespace string // written by MarshalXML, chosen from the CPL's Format
+}
+
+// MarshalXML writes the asset as a prefixed element of the stereoscopic
+// picture namespace, leaving its children in the CPL's
+func (p StereoscopicPicture) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	namespace := p.namespace
+	if namespace == "" {
+		namespace = smpteStereoNamespace
+	}
+	start.Name = xml.Name{Local: "msp-cpl:MainStereoscopicPicture"}
+	start.Attr = []xml.Attr{{Name: xml.Name{Local: "xmlns:msp-cpl"}, Value: namespace}}
+	return e.EncodeElement(p.Picture, start)
 }
 
 // Sound is a specific form of a CPL asset
 type Sound struct {
 	Asset
-	Language string
+	Language string `xml:",omitempty" json:"language,omitempty"`
 }
 
 // Subtitle is a specific form of a CPL asset
 type Subtitle struct {
 	Asset
-	Language string
+	Language string `xml:",omitempty" json:"language,omitempty"`
 }
 
-// Reel is a reel from a CPL
+// Reel is a reel from a CPL; MainMarkers comes first in the AssetList, as
+// ST 429-7 orders it
 type Reel struct {
-	ID       string    `xml:"Id"`
-	Picture  *Picture  `xml:"AssetList>MainPicture"`
-	Sound    *Sound    `xml:"AssetList>MainSound"`
-	Subtitle *Subtitle `xml:"AssetList>MainSubtitle"`
+	ID                  string               `xml:"Id" json:"id"`
+	Markers             *Markers             `xml:"AssetList>MainMarkers" json:"markers,omitempty"`
+	Picture             *Picture             `xml:"AssetList>MainPicture" json:"picture,omitempty"`
+	StereoscopicPicture *StereoscopicPicture `xml:"AssetList>MainStereoscopicPicture" json:"stereoscopicPicture,omitempty"`
+	Sound               *Sound               `xml:"AssetList>MainSound" json:"sound,omitempty"`
+	Subtitle            *Subtitle            `xml:"AssetList>MainSubtitle" json:"subtitle,omitempty"`
+}
+
+// Assets returns the assets referenced by a reel
+func (reel Reel) Assets() []*Asset {
+	var assets []*Asset
+	if reel.Picture != nil {
+		assets = append(assets, &reel.Picture.Asset)
+	}
+	if reel.StereoscopicPicture != nil {
+		assets = append(assets, &reel.StereoscopicPicture.Asset)
+	}
+	if reel.Sound != nil {
+		assets = append(assets, &reel.Sound.Asset)
+	}
+	if reel.Subtitle != nil {
+		assets = append(assets, &reel.Subtitle.Asset)
+	}
+	return assets
+}
+
+// IsEncrypted reports whether any of the CPL's assets are encrypted, in
+// which case a KDM is needed to play it
+func (cpl CPL) IsEncrypted() bool {
+	return len(cpl.KeyIDs()) > 0
+}
+
+// KeyIDs returns the IDs of the keys needed to decrypt the CPL's assets,
+// without duplicates
+func (cpl CPL) KeyIDs() []string {
+	var keyIDs []string
+	seen := map[string]bool{}
+	for _, reel := range cpl.Reels {
+		for _, asset := range reel.Assets() {
+			if asset.KeyID != "" && !seen[asset.KeyID] {
+				seen[asset.KeyID] = true
+				keyIDs = append(keyIDs, asset.KeyID)
+			}
+		}
+	}
+	return keyIDs
 }
 
-// Pictures returns all the picture assets in a CPL
+// Pictures returns all the picture assets in a CPL, both 2D and stereoscopic
 func (cpl CPL) Pictures() []*Picture {
 	pictures := make([]*Picture, 0, len(cpl.Reels))
 	for _, reel := range cpl.Reels {
 		if reel.Picture != nil {
 			pictures = append(pictures, reel.Picture)
 		}
+		if reel.StereoscopicPicture != nil {
+			pictures = append(pictures, &reel.StereoscopicPicture.Picture)
+		}
 	}
 	return pictures
 }
 
+// Is3D reports whether any of the CPL's reels has a stereoscopic picture
+func (cpl CPL) Is3D() bool {
+	for _, reel := range cpl.Reels {
+		if reel.StereoscopicPicture != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // Sounds returns all the sound assets in a CPL
 func (cpl CPL) Sounds() []*Sound {
 	sounds := make([]*Sound, 0, len(cpl.Reels))
@@ -128,6 +304,15 @@ func ParseCPLFile(filename string) (*CPL, error) {
 	return ParseCPL(xmlStr)
 }
 
+// ParseCPLReader parses a CPL XML document read from r
+func ParseCPLReader(r io.Reader) (*CPL, error) {
+	xmlStr, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCPL(xmlStr)
+}
+
 // ParseCPL parses a CPL XML string
 func ParseCPL(xmlStr []byte) (*CPL, error) {
 	var cplXML cplXML
@@ -136,7 +321,11 @@ func ParseCPL(xmlStr []byte) (*CPL, error) {
 		return nil, err
 	}
 	cpl, err := makeCPL(&cplXML)
-	return cpl, err
+	if err != nil {
+		return nil, err
+	}
+	cpl.raw = xmlStr
+	return cpl, nil
 }
 
 /*
@@ -144,14 +333,24 @@ cplXML is used to unmarshall XML; used internally only - CPL struct
 is passed back by ParseCPL() & ParseCPLFile()
 */
 type cplXML struct {
+	XMLName          xml.Name
 	Xmlns            string `xml:"xmlns,attr"`
 	ID               string `xml:"Id"`
-	AnnotationText   string
+	AnnotationText   string `xml:",omitempty"`
 	IssueDate        time.Time
-	Creator          string
+	Creator          string `xml:",omitempty"`
 	ContentTitleText string
-	ContentKind      string
+	ContentKind      contentKindXML
+	RatingList       struct{}
 	Reels            []*Reel `xml:"ReelList>Reel"`
+	Signer           *Signer `xml:",omitempty"`
+}
+
+// contentKindXML is the ContentKind element, whose scope is set in SMPTE
+// CPLs using kinds outside the standard list
+type contentKindXML struct {
+	Scope string `xml:"scope,attr,omitempty"`
+	Text  string `xml:",chardata"`
 }
 
 // makeCPL creates a CPL from a raw cplXML
@@ -161,21 +360,61 @@ func makeCPL(cplXML *cplXML) (*CPL, error) {
 		AnnotationText:   cplXML.AnnotationText,
 		IssueDate:        cplXML.IssueDate,
 		Creator:          cplXML.Creator,
-		ContentTitleText: cplXML.ContentTitleText}
-	if cplXML.Xmlns == "http://www.digicine.com/PROTO-ASDCP-CPL-20040511#" {
+		ContentTitleText: cplXML.ContentTitleText,
+		Signer:           cplXML.Signer}
+	if cplXML.Xmlns == interopCPLNamespace {
 		cpl.Format = INTEROP
-	} else if cplXML.Xmlns == "http://www.smpte-ra.org/schemas/429-7/2006/CPL" {
+	} else if cplXML.Xmlns == smpteCPLNamespace {
 		cpl.Format = SMPTE
 	}
-	// Set the content kind
-	switch cplXML.ContentKind {
-	case "test":
-		cpl.ContentKind = testCPLKind
-	case "feature":
-		cpl.ContentKind = featureCPLKind
-	case "advertisement":
-		cpl.ContentKind = advertisementCPLKind
+	// Set the content kind; kinds in other scopes are kept as text
+	cpl.ContentKindScope = cplXML.ContentKind.Scope
+	if cpl.ContentKindScope == "" || cpl.ContentKindScope == smpteContentKindScope {
+		cpl.ContentKind = ParseContentKind(cplXML.ContentKind.Text)
+	}
+	if cpl.ContentKind == ContentKindUnknown {
+		cpl.ContentKindText = strings.TrimSpace(cplXML.ContentKind.Text)
 	}
 	cpl.Reels = cplXML.Reels
 	return &cpl, nil
 }
+
+// MarshalCPL produces the CPL's XML document; the namespace is chosen
+// from the CPL's Format
+func MarshalCPL(cpl *CPL) ([]byte, error) {
+	cplXML := cplXML{
+		XMLName:          xml.Name{Local: "CompositionPlaylist"},
+		ID:               cpl.ID,
+		AnnotationText:   cpl.AnnotationText,
+		IssueDate:        cpl.IssueDate,
+		Creator:          cpl.Creator,
+		ContentTitleText: cpl.ContentTitleText}
+	stereoNamespace := smpteStereoNamespace
+	switch cpl.Format {
+	case INTEROP:
+		cplXML.Xmlns = interopCPLNamespace
+		stereoNamespace = interopStereoNamespace
+	case SMPTE:
+		cplXML.Xmlns = smpteCPLNamespace
+	default:
+		return nil, errors.New("Unable to marshal a CPL of unknown format")
+	}
+	cplXML.ContentKind.Text = cpl.ContentKindText
+	if cpl.ContentKind != ContentKindUnknown {
+		cplXML.ContentKind.Text = cpl.ContentKind.String()
+	}
+	if cpl.Format == SMPTE {
+		cplXML.ContentKind.Scope = cpl.ContentKindScope
+	}
+	// Copy the reels to set the namespace of their stereoscopic pictures
+	for _, reel := range cpl.Reels {
+		reelCopy := *reel
+		if reel.StereoscopicPicture != nil {
+			picture := *reel.StereoscopicPicture
+			picture.namespace = stereoNamespace
+			reelCopy.StereoscopicPicture = &picture
+		}
+		cplXML.Reels = append(cplXML.Reels, &reelCopy)
+	}
+	return marshalXML(&cplXML)
+}
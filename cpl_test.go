@@ -16,8 +16,13 @@
 package dcp
 
 import (
+	"bytes"
+	"crypto/x509"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/googlesamples/dcp/xmldsig"
 )
 
 // XML doc taken from DCPs available at http://www.freedcp.net
@@ -57,6 +62,90 @@ var testCPLXML = []byte(`<?xml version="1.0" encoding="UTF-8"?>
   </ReelList>
 </CompositionPlaylist>`)
 
+// Signed SMPTE CPL, signed by a test certificate chain that was only valid
+// during 2015, around its IssueDate
+var testSignedCPLXML = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CompositionPlaylist xmlns="http://www.smpte-ra.org/schemas/429-7/2006/CPL" xmlns:dsig="http://www.w3.org/2000/09/xmldsig#">
+  <Id>urn:uuid:b5d2a0bd-ec5a-4bd9-9d1e-cbd5c1f2b5b4</Id>
+  <AnnotationText>Signed Test</AnnotationText>
+  <IssueDate>2015-06-01T10:00:00+00:00</IssueDate>
+  <Creator>dcp-parser-go</Creator>
+  <ContentTitleText>Signed Test</ContentTitleText>
+  <ContentKind>test</ContentKind>
+  <RatingList/>
+  <ReelList>
+    <Reel>
+      <Id>urn:uuid:6e1ae6d3-3b1c-4b0a-8f41-0c6d7f7d9c0e</Id>
+      <AssetList>
+        <MainPicture>
+          <Id>urn:uuid:0b0d3c8c-4bba-4f3a-a6a3-1a0c6f0a3c6e</Id>
+          <EditRate>24 1</EditRate>
+          <IntrinsicDuration>48</IntrinsicDuration>
+          <EntryPoint>0</EntryPoint>
+          <Duration>48</Duration>
+          <FrameRate>24 1</FrameRate>
+          <ScreenAspectRatio>1998 1080</ScreenAspectRatio>
+        </MainPicture>
+      </AssetList>
+    </Reel>
+  </ReelList>
+  <Signer>
+    <dsig:X509Data>
+      <dsig:X509IssuerSerial>
+        <dsig:X509IssuerName>CN=root.example.com</dsig:X509IssuerName>
+        <dsig:X509SerialNumber>2</dsig:X509SerialNumber>
+      </dsig:X509IssuerSerial>
+      <dsig:X509SubjectName>CN=cs.leaf.example.com</dsig:X509SubjectName>
+    </dsig:X509Data>
+  </Signer>
+  <ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+    <ds:SignedInfo>
+      <ds:CanonicalizationMethod Algorithm="http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments"/>
+      <ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>
+      <ds:Reference URI="">
+        <ds:Transforms>
+          <ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>
+        </ds:Transforms>
+        <ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>
+        <ds:DigestValue>dfNydnuzdCxtjiLfLBSOdR6bI9gf7I0NGDOhPebvoyk=</ds:DigestValue>
+      </ds:Reference>
+    </ds:SignedInfo>
+    <ds:SignatureValue>
+      qc+gjqQ8ZNp9zpIIwuL3g6RnKfa0UXlPnJaZ8+s4MXXNDIR5rL8XWd1dMKP0OjoY
+      4XGx5NNI4pSKSunpfoGfM4+7Bi+HepWfxgLbDWGILdNM5KcrslK7gd4h5m2+Xdb+
+      Fko1b90Nj6Fu7yP3iTSnnuq7eA76b8OAjHN1RJ+qcdI=
+    </ds:SignatureValue>
+    <ds:KeyInfo>
+      <ds:X509Data><ds:X509Certificate>
+        MIIB8DCCAVmgAwIBAgIBAjANBgkqhkiG9w0BAQsFADAbMRkwFwYDVQQDExByb290
+        LmV4YW1wbGUuY29tMB4XDTE1MDEwMTAwMDAwMFoXDTE2MDEwMTAwMDAwMFowHjEc
+        MBoGA1UEAxMTY3MubGVhZi5leGFtcGxlLmNvbTCBnzANBgkqhkiG9w0BAQEFAAOB
+        jQAwgYkCgYEAtaBaOPmqIPX/KBN+qnavLjoQ+cccGZkAnoFdtASrjSEs1JV9eak1
+        PGe2FKG9T+BFm/nvulSs3/I8mYi7mR/XpfUe/37by4jxqbkT4lj+doteYhVsFgrX
+        LSaDD/IhotU6Gqws0DW4ATL27z/lfjfc4Ji3ce6rH24H9Xp2eplswqkCAwEAAaNB
+        MD8wDgYDVR0PAQH/BAQDAgKEMAwGA1UdEwEB/wQCMAAwHwYDVR0jBBgwFoAUUp7R
+        W95u/KaiX3/VN/4I6PByJNwwDQYJKoZIhvcNAQELBQADgYEAN5FdVzI4mOAqXjgU
+        qr6g2asUfk7KxxujqBCaKqRgeUgCq3CuA48fwVnOXZ9T509cJdwPssaoQOu3g0mX
+        6rNjmSb9197yHSQlIQ+LYqODN7YRJdZUx7OFJZ0vbCmc0WWB9m+KNeM+zQ8aXvpG
+        dpIkTCVOrABpBrnw5kfUEFXXmOI=
+      </ds:X509Certificate></ds:X509Data>
+      <ds:X509Data><ds:X509Certificate>
+        MIIB7jCCAVegAwIBAgIBATANBgkqhkiG9w0BAQsFADAbMRkwFwYDVQQDExByb290
+        LmV4YW1wbGUuY29tMB4XDTE1MDEwMTAwMDAwMFoXDTE2MDEwMTAwMDAwMFowGzEZ
+        MBcGA1UEAxMQcm9vdC5leGFtcGxlLmNvbTCBnzANBgkqhkiG9w0BAQEFAAOBjQAw
+        gYkCgYEAtB93MG9SxrZy2KWOgsUncd4M8pEunGtJ3SWHiNsOLVsvMYU+K2TR6GXL
+        QdastksUyLXj9nzQqHWNFBvh1pQ5Ophe9ztQDDnZOf+S68fccHVDsOxj0RTOZO1Y
+        kBmscFjoqVxOaXd5ZuuI6tMPyD1XOv7xe4aY7NK1OMNsEkTOUvkCAwEAAaNCMEAw
+        DgYDVR0PAQH/BAQDAgKEMA8GA1UdEwEB/wQFMAMBAf8wHQYDVR0OBBYEFFKe0Vve
+        bvymol9/1Tf+COjwciTcMA0GCSqGSIb3DQEBCwUAA4GBAKJp1kGj7jbKC3g+Rm0m
+        xPkNBQmlNvtLgFJt4vUZGsK8OC4qttp812L4NvC+G+huKZDV6w7YcQ7KaSIje6za
+        nMvJG0p7wAuIlVoM7HkiQMMMJOTlZRPC3hJBQZsE2ffwsH9sFSuDaX7RSwufdxtS
+        T332uOf6hnNCMz2wOe/PhDza
+      </ds:X509Certificate></ds:X509Data>
+    </ds:KeyInfo>
+  </ds:Signature>
+</CompositionPlaylist>`)
+
 func parseCPL(t *testing.T) *CPL {
 	cpl, err := ParseCPL(testCPLXML)
 	if err != nil {
@@ -106,7 +195,7 @@ func TestCPL(t *testing.T) {
 			cpl.ContentTitleText, expectedTitle)
 	}
 	// test ContentKind
-	expectedKind := testCPLKind
+	expectedKind := ContentKindTest
 	if cpl.ContentKind != expectedKind {
 		t.Errorf("ContentKind is incorrect: %d != %d",
 			cpl.ContentKind, expectedKind)
@@ -167,3 +256,313 @@ func TestCPLSubtitleCount(t *testing.T) {
 		t.Errorf("Subtitles count is incorrect: %d != %d", len(cpl.Subtitles()), expectedSubtitleCount)
 	}
 }
+
+func TestMarshalCPL(t *testing.T) {
+	cpl := parseCPL(t)
+	cpl.ContentTitleText = "Edited Title"
+	cpl.Format = SMPTE
+	xmlStr, err := MarshalCPL(cpl)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	cpl2, err := ParseCPL(xmlStr)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if cpl2.Format != SMPTE {
+		t.Errorf("Format is incorrect: %d != %d", cpl2.Format, SMPTE)
+	}
+	if cpl2.ContentTitleText != cpl.ContentTitleText {
+		t.Errorf("ContentTitleText is incorrect: %s != %s",
+			cpl2.ContentTitleText, cpl.ContentTitleText)
+	}
+	if cpl2.ContentKind != cpl.ContentKind {
+		t.Errorf("ContentKind is incorrect: %d != %d", cpl2.ContentKind, cpl.ContentKind)
+	}
+	if !cpl2.IssueDate.Equal(cpl.IssueDate) {
+		t.Errorf("IssueDate is incorrect: %s != %s", cpl2.IssueDate, cpl.IssueDate)
+	}
+	if len(cpl2.Reels) != 1 || cpl2.Reels[0].Picture.Duration != 23400 ||
+		cpl2.Reels[0].Sound.IntrinsicDuration != 24404 {
+		t.Errorf("Reels were not marshalled correctly")
+	}
+	cpl.Format = UNKNOWN
+	if _, err := MarshalCPL(cpl); err == nil {
+		t.Errorf("Marshalling a CPL of unknown format should fail")
+	}
+}
+
+func TestMarshalCPLUnsetAsset(t *testing.T) {
+	cpl := parseCPL(t)
+	cpl.Format = SMPTE
+	// A reel asset without an edit rate or duration
+	cpl.Reels[0].Sound = &Sound{Asset: Asset{ID: "urn:uuid:5fbb3067-4166-4a19-9ba2-0a2b4c5cd397",
+		IntrinsicDuration: 24}}
+	cpl.Reels[0].Picture.FrameRate = EditRate{}
+	xmlStr, err := MarshalCPL(cpl)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	sound := string(xmlStr[bytes.Index(xmlStr, []byte("<MainSound>")):])
+	sound = sound[:strings.Index(sound, "</MainSound>")]
+	if strings.Contains(sound, "<EditRate") || strings.Contains(sound, "<Duration") {
+		t.Errorf("Unset EditRate and Duration should be left out: %s", sound)
+	}
+	if !strings.Contains(sound, "<IntrinsicDuration>24<") {
+		t.Errorf("IntrinsicDuration is missing: %s", sound)
+	}
+	if strings.Contains(string(xmlStr), "<FrameRate") {
+		t.Errorf("Unset FrameRate should be left out: %s", xmlStr)
+	}
+	cpl2, err := ParseCPL(xmlStr)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !cpl2.Reels[0].Sound.EditRate.IsZero() || cpl2.Reels[0].Sound.Duration != 0 ||
+		cpl2.Reels[0].Picture.EditRate != cpl.Reels[0].Picture.EditRate {
+		t.Errorf("Edit rates are incorrect: %s, %s",
+			cpl2.Reels[0].Sound.EditRate, cpl2.Reels[0].Picture.EditRate)
+	}
+}
+
+func TestContentKind(t *testing.T) {
+	for kind := ContentKindUnknown; kind <= ContentKindStereocard; kind++ {
+		text, err := kind.MarshalText()
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		var parsed ContentKind
+		if err := parsed.UnmarshalText(text); err != nil || parsed != kind {
+			t.Errorf("ContentKind is incorrect after a round trip: %s != %s", parsed, kind)
+		}
+	}
+	if kind := ParseContentKind(" Feature\n"); kind != ContentKindFeature {
+		t.Errorf("ContentKind is incorrect: %s != %s", kind, ContentKindFeature)
+	}
+	var kind ContentKind
+	if err := kind.UnmarshalText([]byte("documentary")); err == nil {
+		t.Error("Unknown content kind unmarshalled")
+	}
+}
+
+func TestCPLContentKindScope(t *testing.T) {
+	cpl := parseCPL(t)
+	cpl.Format = SMPTE
+	cpl.ContentKind = ContentKindUnknown
+	cpl.ContentKindScope = "http://example.com/content-kind"
+	cpl.ContentKindText = "feature"
+	xmlStr, err := MarshalCPL(cpl)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	expected := `<ContentKind scope="http://example.com/content-kind">feature</ContentKind>`
+	if !strings.Contains(string(xmlStr), expected) {
+		t.Errorf("ContentKind is incorrect: %s", xmlStr)
+	}
+	// Kinds in other scopes aren't the standard kinds of the same name
+	cpl2, err := ParseCPL(xmlStr)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if cpl2.ContentKind != ContentKindUnknown || cpl2.ContentKindText != "feature" ||
+		cpl2.ContentKindScope != cpl.ContentKindScope {
+		t.Errorf("ContentKind is incorrect: %s %s %s",
+			cpl2.ContentKind, cpl2.ContentKindText, cpl2.ContentKindScope)
+	}
+	cpl2.ContentKindScope = smpteContentKindScope
+	xmlStr, _ = MarshalCPL(cpl2)
+	if cpl3, _ := ParseCPL(xmlStr); cpl3 == nil || cpl3.ContentKind != ContentKindFeature {
+		t.Errorf("ContentKind in the standard scope should be parsed: %s", xmlStr)
+	}
+}
+
+func TestCPLVerifySignature(t *testing.T) {
+	cpl, err := ParseCPL(testSignedCPLXML)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if cpl.Signer == nil || cpl.Signer.SerialNumber != "2" ||
+		cpl.Signer.SubjectName != "CN=cs.leaf.example.com" {
+		t.Fatalf("Signer is incorrect: %+v", cpl.Signer)
+	}
+	chain, err := cpl.VerifySignature(nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(chain) != 2 || chain[0].Subject.CommonName != "cs.leaf.example.com" {
+		t.Errorf("Certificate chain is incorrect: %v", chain)
+	}
+	// The certificates have long expired, but were valid when it was issued
+	issued := cpl.IssueDate
+	cpl.IssueDate = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := cpl.VerifySignature(nil); err == nil || !strings.Contains(err.Error(), "valid") {
+		t.Errorf("CPL issued after its signer expired should fail verification: %v", err)
+	}
+	cpl.IssueDate = issued
+	// Only the chain's own root is trusted
+	roots := x509.NewCertPool()
+	roots.AddCert(chain[1])
+	if _, err := cpl.VerifySignature(roots); err != nil {
+		t.Errorf("Chain to a trusted root should verify: %s", err)
+	}
+	if _, err := cpl.VerifySignature(x509.NewCertPool()); err == nil {
+		t.Errorf("Chain to an untrusted root should not verify")
+	}
+	// Editing the signed content breaks the signature
+	tampered := strings.Replace(string(testSignedCPLXML),
+		"<Duration>48</Duration>", "<Duration>47</Duration>", 1)
+	if cpl, err = ParseCPL([]byte(tampered)); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := cpl.VerifySignature(nil); err == nil {
+		t.Errorf("Tampered CPL should fail verification")
+	}
+	// The Signer must name the signing certificate
+	wrongSigner := strings.Replace(string(testSignedCPLXML),
+		"<dsig:X509SerialNumber>2<", "<dsig:X509SerialNumber>3<", 1)
+	if cpl, err = ParseCPL([]byte(wrongSigner)); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := cpl.VerifySignature(nil); err == nil {
+		t.Errorf("CPL whose Signer doesn't match should fail verification")
+	}
+	// A certificate with the same serial from another issuer
+	wrongIssuer := strings.Replace(string(testSignedCPLXML),
+		"<dsig:X509IssuerName>CN=root.example.com<", "<dsig:X509IssuerName>CN=other.example.com<", 1)
+	if cpl, err = ParseCPL([]byte(wrongIssuer)); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := cpl.VerifySignature(nil); err == nil {
+		t.Errorf("CPL whose Signer issuer doesn't match should fail verification")
+	}
+}
+
+func TestCPLUnsigned(t *testing.T) {
+	cpl := parseCPL(t)
+	if cpl.Signer != nil {
+		t.Errorf("Unsigned CPL should have no Signer")
+	}
+	if _, err := cpl.VerifySignature(nil); err != xmldsig.ErrUnsigned {
+		t.Errorf("Unsigned CPL should return ErrUnsigned: %v", err)
+	}
+}
+
+func TestCheckSignatures(t *testing.T) {
+	signed, err := ParseCPL(testSignedCPLXML)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	unsigned, err := ParseCPL([]byte(strings.Replace(string(testSignedCPLXML),
+		"ds:Signature", "ds:NotSignature", -1)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	unsigned.ID = "urn:uuid:unsigned"
+	tampered, err := ParseCPL([]byte(strings.Replace(string(testSignedCPLXML),
+		"Signed Test", "Tampered", 1)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	tampered.ID = "urn:uuid:tampered"
+	dcp := &DCP{AssetMap: &AssetMap{}, CPLs: []*CPL{signed, unsigned, tampered, parseCPL(t)}}
+	report := &Report{}
+	checkSignatures(dcp, report)
+	if len(report.Findings) != 2 {
+		t.Fatalf("Finding count is incorrect: %d != %d", len(report.Findings), 2)
+	}
+	if f := report.Findings[0]; f.Code != CodeUnsigned || f.AssetID != unsigned.ID {
+		t.Errorf("Unsigned SMPTE CPL finding is incorrect: %s %s", f.Code, f.AssetID)
+	}
+	if f := report.Findings[1]; f.Code != CodeSignatureInvalid || f.AssetID != tampered.ID {
+		t.Errorf("Tampered CPL finding is incorrect: %s %s", f.Code, f.AssetID)
+	}
+	// With trusted roots that didn't issue the signer
+	dcp = &DCP{AssetMap: &AssetMap{}, CPLs: []*CPL{signed}, Roots: x509.NewCertPool()}
+	report = &Report{}
+	checkSignatures(dcp, report)
+	if len(report.Findings) != 1 || report.Findings[0].Code != CodeSignatureInvalid {
+		t.Errorf("Untrusted signer should be reported: %v", report.Findings)
+	}
+}
+
+// testEncryptedCPLXML adds a KeyId and Hash to the test CPL's assets
+var testEncryptedCPLXML = []byte(strings.Replace(string(testCPLXML),
+	"<Duration>23400</Duration>", `<Duration>23400</Duration>
+          <KeyId>urn:uuid:00112233-4455-6677-8899-aabbccddeeff</KeyId>
+          <Hash>R53oZs3TlqpWkRa1AhcduI8glak=</Hash>`, -1))
+
+func TestCPLKeyIDs(t *testing.T) {
+	cpl := parseCPL(t)
+	if cpl.IsEncrypted() || len(cpl.KeyIDs()) != 0 {
+		t.Errorf("Test CPL should not be encrypted")
+	}
+	cpl, err := ParseCPL(testEncryptedCPLXML)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !cpl.IsEncrypted() {
+		t.Errorf("CPL with key ids should be encrypted")
+	}
+	// Both assets share the key, which is listed once
+	keyIDs := cpl.KeyIDs()
+	expectedID := "urn:uuid:00112233-4455-6677-8899-aabbccddeeff"
+	if len(keyIDs) != 1 || keyIDs[0] != expectedID {
+		t.Errorf("Key ids are incorrect: %v", keyIDs)
+	}
+	expectedHash := "R53oZs3TlqpWkRa1AhcduI8glak="
+	if cpl.Reels[0].Picture.Hash != expectedHash {
+		t.Errorf("Picture hash is incorrect: %s != %s", cpl.Reels[0].Picture.Hash, expectedHash)
+	}
+}
+
+// testStereoscopicCPLXML turns the test CPL's picture into a stereoscopic
+// picture, whose frame rate is twice its edit rate
+var testStereoscopicCPLXML = []byte(strings.NewReplacer(
+	"<MainPicture>", `<msp-cpl:MainStereoscopicPicture xmlns:msp-cpl="http://www.digicine.com/schemas/437-Y/2007/Main-Stereo-Picture-CPL">`,
+	"</MainPicture>", "</msp-cpl:MainStereoscopicPicture>",
+	"<FrameRate>24 1</FrameRate>", "<FrameRate>48 1</FrameRate>").Replace(string(testCPLXML)))
+
+func TestCPLStereoscopic(t *testing.T) {
+	if parseCPL(t).Is3D() {
+		t.Errorf("Test CPL should not be 3D")
+	}
+	cpl, err := ParseCPL(testStereoscopicCPLXML)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !cpl.Is3D() || cpl.Reels[0].Picture != nil {
+		t.Fatalf("CPL should be 3D")
+	}
+	picture := cpl.Reels[0].StereoscopicPicture
+	if picture.ID != "urn:uuid:db95199c-0e2f-4ac4-9e54-b97919dcdf07" ||
+		picture.FrameRate != (EditRate{48, 1}) || picture.EditRate != (EditRate{24, 1}) {
+		t.Errorf("Stereoscopic picture is incorrect: %+v", picture)
+	}
+	if pictures := cpl.Pictures(); len(pictures) != 1 || pictures[0] != &picture.Picture {
+		t.Errorf("Stereoscopic picture should be in Pictures: %v", pictures)
+	}
+	if len(cpl.Reels[0].Assets()) != 2 || cpl.EditRate() != (EditRate{24, 1}) {
+		t.Errorf("Stereoscopic picture should be a reel asset")
+	}
+	// The namespace follows the CPL's format
+	for format, namespace := range map[Format]string{
+		INTEROP: interopStereoNamespace,
+		SMPTE:   smpteStereoNamespace} {
+		cpl.Format = format
+		xmlStr, err := MarshalCPL(cpl)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		expected := `<msp-cpl:MainStereoscopicPicture xmlns:msp-cpl="` + namespace + `">`
+		if !strings.Contains(string(xmlStr), expected) {
+			t.Errorf("Stereoscopic picture namespace is incorrect: %s", xmlStr)
+		}
+		cpl2, err := ParseCPL(xmlStr)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if !cpl2.Is3D() || cpl2.Reels[0].StereoscopicPicture.Duration != 23400 {
+			t.Errorf("Stereoscopic picture was not marshalled correctly: %s", xmlStr)
+		}
+	}
+}
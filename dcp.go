@@ -17,10 +17,12 @@ package dcp
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/xml"
 	"errors"
-	"io/ioutil"
+	"io/fs"
 	"os"
-	"path/filepath"
 	"regexp"
 )
 
@@ -30,8 +32,21 @@ type DCP struct {
 	AssetMap *AssetMap
 	CPLs     []*CPL
 	PKLs     []*PKL
+	Volumes  []*Volume // volumes the DCP was loaded from
+
+	// Roots are the trusted roots that CPL and PKL signatures are checked
+	// against when validating; if nil only the structure of the
+	// certificate chains is checked
+	Roots *x509.CertPool
+
+	// VF marks the DCP as a version file, so reel assets in neither its PKLs
+	// nor its asset map are taken to be held by an OV and only warned about
+	// when validating; CheckVF resolves them
+	VF bool
 
 	assetMapFile string
+	volumes      map[int]fs.FS     // file systems of the volumes by index; nil for RootDir on disk
+	hashes       map[string]string // Base64 SHA-1 of files already hashed, by name on volume 1
 }
 
 // String produces a human-readable representation of a DCP
@@ -63,87 +78,41 @@ func (dcp *DCP) Files() []string {
 	return append([]string{dcp.assetMapFile}, dcp.AssetMap.Paths()...)
 }
 
-// Generate builds a new DCP from a root directory path containing an assetmap
+// Generate builds a new DCP from a root directory path containing an assetmap;
+// it returns the first error found, use Validate to find all of them
 func (dcp *DCP) Generate(dir string) error {
-	amFileName, err := findAssetMap(dir)
-	if err != nil {
-		return err
-	}
-	am, err := ParseAssetMapFile(amFileName)
-	if err != nil {
-		return err
-	}
-	dcp.RootDir = dir
-	dcp.assetMapFile = filepath.Base(amFileName)
-	for _, asset := range am.Assets {
-		for _, chunk := range asset.Chunks {
-			// Check the file size
-			assetPath := filepath.Join(dir, chunk.Path)
-			err = checkFileSize(assetPath, chunk.Size)
-			if err != nil {
-				return err
-			}
-			// Determine the asset type
-			aType := assetType(assetPath)
-			// Parse CPLs and PKLs
-			if aType == CPLAssetType {
-				cpl, err := ParseCPLFile(assetPath)
-				if err != nil {
-					return err
-				}
-				dcp.CPLs = append(dcp.CPLs, cpl)
-			}
-			if aType == PKLAssetType {
-				pkl, err := ParsePKLFile(assetPath)
-				if err != nil {
-					return err
-				}
-				dcp.PKLs = append(dcp.PKLs, pkl)
-			}
-		}
-	}
-	dcp.AssetMap = am
-	return nil
+	report := &Report{}
+	dcp.load([]fs.FS{os.DirFS(dir)}, []string{dir}, report)
+	return report.Err()
 }
 
 /*
-findAssetMap looks in a directory for an assetmap
-and if found returns its absolute path
+findAssetMap looks in the root of a file system for an assetmap
+and if found returns its name
 */
-func findAssetMap(dir string) (string, error) {
-	files, err := ioutil.ReadDir(dir)
+func findAssetMap(fsys fs.FS) (string, error) {
+	files, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return "", err
 	}
 	for _, f := range files {
-		if regexp.MustCompile(`^(assetmap|ASSETMAP)(.xml|.XML)*$`).
-			MatchString(f.Name()) {
-			return filepath.Join(dir, f.Name()), nil
+		if assetMapRegExp.MatchString(f.Name()) {
+			return f.Name(), nil
 		}
 	}
 	return "", errors.New("Unable to find an assetmap file")
 }
 
-// Check if a file exists and that it's the correct size
-func checkFileSize(filename string, size uint64) error {
-	info, err := os.Stat(filename)
-	if err != nil {
-		return err
-	}
-	fileSize := info.Size()
-	if uint64(fileSize) != size {
-		return errors.New("File size for" + filename + " is incorrect")
-	}
-	return nil
-}
+// assetMapRegExp matches the file names of assetmaps
+var assetMapRegExp = regexp.MustCompile(`^(assetmap|ASSETMAP)(.xml|.XML)*$`)
 
 // mxfHeader is the starting bytes of an audio or picture MXF file
 var mxfHeader = []byte{6, 14, 43, 52, 2, 5, 1, 1, 13, 1, 2, 1, 1, 2,
 	4, 0, 131, 0, 0, 120, 0, 1, 0, 2, 0, 0, 0, 1}
 
 // Determine the asset type from the file
-func assetType(filepath string) AssetType {
-	data, err := readHeader(filepath)
+func assetType(fsys fs.FS, name string) AssetType {
+	data, err := readHeader(fsys, name)
 	if err != nil {
 		return UnknownAssetType
 	}
@@ -161,11 +130,32 @@ func assetType(filepath string) AssetType {
 
 // readHeader reads the first 100 bytes from a file;
 // returns an error if the file can't be read
-func readHeader(filepath string) ([]byte, error) {
+func readHeader(fsys fs.FS, name string) ([]byte, error) {
 	data := make([]byte, 100)
-	file, err := os.Open(filepath)
+	file, err := fsys.Open(name)
 	if err == nil {
 		_, err = file.Read(data)
+		file.Close()
 	}
 	return data, err
 }
+
+// marshalXML produces an indented XML document, with the XML declaration
+func marshalXML(v interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// newUUID returns a random (version 4) UUID as a urn:uuid URN
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b), nil
+}
@@ -0,0 +1,213 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Rational edit rates, and conversions between edit units, times and SMPTE
+timecode
+*/
+
+package dcp
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EditRate is a rational number of edit units, such as frames, per second;
+// it's written "24 1" or "24000 1001" in CPLs. The zero EditRate is unset
+type EditRate struct {
+	Numerator   int64
+	Denominator int64
+}
+
+// ParseEditRate parses an edit rate written as a numerator and denominator
+// separated by white space, such as "24 1"
+func ParseEditRate(s string) (EditRate, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return EditRate{}, errors.New("Invalid edit rate: " + s)
+	}
+	num, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || num <= 0 {
+		return EditRate{}, errors.New("Invalid edit rate: " + s)
+	}
+	den, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || den <= 0 {
+		return EditRate{}, errors.New("Invalid edit rate: " + s)
+	}
+	return EditRate{num, den}, nil
+}
+
+// String returns the edit rate as it's written in a CPL, or an empty string
+// if it's unset
+func (r EditRate) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d %d", r.Numerator, r.Denominator)
+}
+
+// IsZero reports whether the edit rate is unset
+func (r EditRate) IsZero() bool {
+	return r == EditRate{}
+}
+
+// valid reports whether the edit rate can be used in conversions
+func (r EditRate) valid() bool {
+	return r.Numerator > 0 && r.Denominator > 0
+}
+
+// MarshalText renders the edit rate as it's written in a CPL
+func (r EditRate) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// MarshalXML writes the edit rate as an element, leaving the element out if
+// the edit rate is unset
+func (r EditRate) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if r.IsZero() {
+		return nil
+	}
+	return e.EncodeElement(r.String(), start)
+}
+
+// UnmarshalText parses an edit rate rendered by MarshalText; empty text is
+// the unset edit rate
+func (r *EditRate) UnmarshalText(text []byte) error {
+	if strings.TrimSpace(string(text)) == "" {
+		*r = EditRate{}
+		return nil
+	}
+	rate, err := ParseEditRate(string(text))
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// UnmarshalXML reads an edit rate element; a malformed edit rate is left
+// unset rather than failing the whole document, so that validating a CPL
+// reports it with the rest of its problems
+func (r *EditRate) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return err
+	}
+	if err := r.UnmarshalText([]byte(text)); err != nil {
+		*r = EditRate{}
+	}
+	return nil
+}
+
+// Float64 returns the edit rate in edit units per second
+func (r EditRate) Float64() float64 {
+	if !r.valid() {
+		return 0
+	}
+	return float64(r.Numerator) / float64(r.Denominator)
+}
+
+// Duration returns the time taken by a number of edit units, rounded down
+// to the nanosecond; it's 0 if the edit rate is unset
+func (r EditRate) Duration(units uint64) time.Duration {
+	if !r.valid() {
+		return 0
+	}
+	// Split into whole seconds and a remainder so that the products can't
+	// overflow for any realistic length
+	n := units * uint64(r.Denominator)
+	num := uint64(r.Numerator)
+	return time.Duration(n/num)*time.Second + time.Duration(n%num*uint64(time.Second)/num)
+}
+
+// Units returns the number of whole edit units in a time, rounded to the
+// nearest; it's 0 if the edit rate is unset
+func (r EditRate) Units(d time.Duration) uint64 {
+	if !r.valid() || d <= 0 {
+		return 0
+	}
+	// d * num / (den * 1s), rounded, without overflowing
+	den := uint64(r.Denominator) * uint64(time.Second)
+	secs, rem := uint64(d)/uint64(time.Second), uint64(d)%uint64(time.Second)
+	whole := secs * uint64(r.Numerator) / uint64(r.Denominator)
+	fracNum := secs*uint64(r.Numerator)%uint64(r.Denominator)*uint64(time.Second) +
+		rem*uint64(r.Numerator)
+	return whole + (fracNum+den/2)/den
+}
+
+// Rescale converts a number of edit units at rate from to this edit rate,
+// rounded to the nearest
+func (r EditRate) Rescale(units uint64, from EditRate) uint64 {
+	if !r.valid() || !from.valid() {
+		return 0
+	}
+	if r == from {
+		return units
+	}
+	num := units * uint64(from.Denominator) * uint64(r.Numerator)
+	den := uint64(from.Numerator) * uint64(r.Denominator)
+	return (num + den/2) / den
+}
+
+// timecodeBase is the number of frames counted each second in timecode,
+// which is the edit rate rounded up, such as 24 for 24000/1001
+func (r EditRate) timecodeBase() uint64 {
+	return uint64((r.Numerator + r.Denominator - 1) / r.Denominator)
+}
+
+/*
+Timecode returns a number of edit units as non-drop-frame SMPTE timecode,
+HH:MM:SS:FF, counting frames at the edit rate rounded up, so that timecode
+for fractional rates such as 24000/1001 runs slower than the clock
+*/
+func (r EditRate) Timecode(units uint64) string {
+	if !r.valid() {
+		return ""
+	}
+	base := r.timecodeBase()
+	frames := units % base
+	secs := units / base
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", secs/3600, secs/60%60, secs%60, frames)
+}
+
+// ParseTimecode parses non-drop-frame SMPTE timecode, HH:MM:SS:FF, written
+// by Timecode, into a number of edit units
+func (r EditRate) ParseTimecode(tc string) (uint64, error) {
+	if !r.valid() {
+		return 0, errors.New("Edit rate is unset")
+	}
+	fields := strings.Split(tc, ":")
+	if len(fields) != 4 {
+		return 0, errors.New("Invalid timecode: " + tc)
+	}
+	var parts [4]uint64
+	for i, field := range fields {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil || len(field) < 2 {
+			return 0, errors.New("Invalid timecode: " + tc)
+		}
+		parts[i] = n
+	}
+	base := r.timecodeBase()
+	if parts[1] > 59 || parts[2] > 59 || parts[3] >= base {
+		return 0, errors.New("Invalid timecode: " + tc)
+	}
+	return ((parts[0]*60+parts[1])*60+parts[2])*base + parts[3], nil
+}
@@ -0,0 +1,96 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseEditRate(t *testing.T) {
+	rate, err := ParseEditRate(" 24000  1001 ")
+	if err != nil {
+		t.Fatalf("Error parsing edit rate: %s", err)
+	}
+	if rate != (EditRate{24000, 1001}) || rate.String() != "24000 1001" {
+		t.Errorf("Edit rate is incorrect: %s", rate)
+	}
+	for _, s := range []string{"", "24", "24 0", "-24 1", "24/1", "24 1 1"} {
+		if _, err := ParseEditRate(s); err == nil {
+			t.Errorf("Invalid edit rate parsed: %q", s)
+		}
+	}
+}
+
+func TestEditRateText(t *testing.T) {
+	data, err := json.Marshal(&Asset{EditRate: EditRate{48, 1}})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	var asset Asset
+	if err := json.Unmarshal(data, &asset); err != nil || asset.EditRate != (EditRate{48, 1}) {
+		t.Errorf("Edit rate is incorrect after a round trip: %s %v", data, err)
+	}
+	var rate EditRate
+	if err := rate.UnmarshalText([]byte("")); err != nil || !rate.IsZero() {
+		t.Errorf("Empty edit rate should be unset: %v", err)
+	}
+}
+
+func TestEditRateConversions(t *testing.T) {
+	ntsc := EditRate{24000, 1001}
+	if d := ntsc.Duration(24000); d != 1001*time.Second {
+		t.Errorf("Duration is incorrect: %s != %s", d, 1001*time.Second)
+	}
+	if units := ntsc.Units(1001 * time.Second); units != 24000 {
+		t.Errorf("Units is incorrect: %d != 24000", units)
+	}
+	// A three hour feature at 24fps doesn't overflow
+	film := EditRate{24, 1}
+	if d := film.Duration(3 * 3600 * 24); d != 3*time.Hour {
+		t.Errorf("Duration is incorrect: %s != %s", d, 3*time.Hour)
+	}
+	if units := film.Units(1020 * time.Millisecond); units != 24 {
+		t.Errorf("Units should round to the nearest: %d != 24", units)
+	}
+	if units := (EditRate{48, 1}).Rescale(25, film); units != 50 {
+		t.Errorf("Rescaled units are incorrect: %d != 50", units)
+	}
+	if d := (EditRate{}).Duration(24); d != 0 {
+		t.Errorf("Unset edit rate should give no duration: %s", d)
+	}
+}
+
+func TestTimecode(t *testing.T) {
+	film := EditRate{24, 1}
+	units := uint64(((1*60+2)*60+3)*24 + 4)
+	if tc := film.Timecode(units); tc != "01:02:03:04" {
+		t.Errorf("Timecode is incorrect: %s != 01:02:03:04", tc)
+	}
+	if parsed, err := film.ParseTimecode("01:02:03:04"); err != nil || parsed != units {
+		t.Errorf("Parsed timecode is incorrect: %d != %d", parsed, units)
+	}
+	// Fractional rates count frames at the rounded up rate
+	if tc := (EditRate{30000, 1001}).Timecode(30); tc != "00:00:01:00" {
+		t.Errorf("Timecode is incorrect: %s != 00:00:01:00", tc)
+	}
+	for _, tc := range []string{"01:02:03", "01:60:00:00", "00:00:00:24", "1:2:3:4"} {
+		if _, err := film.ParseTimecode(tc); err == nil {
+			t.Errorf("Invalid timecode parsed: %s", tc)
+		}
+	}
+}
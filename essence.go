@@ -0,0 +1,153 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Essence descriptors of the picture and sound MXF assets in a DCP
+*/
+
+package dcp
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+
+	"github.com/googlesamples/dcp/mxf"
+)
+
+// Essence describes the picture or sound essence of an MXF asset
+type Essence struct {
+	AssetID string
+	Type    AssetType
+	Path    string                 // path of the asset relative to the DCP root
+	Picture *mxf.PictureDescriptor // set for MXFPictureAssetType assets
+	Sound   *mxf.SoundDescriptor   // set for MXFSoundAssetType assets
+	Err     error                  // set if the asset couldn't be read
+}
+
+// String summarises the essence, e.g. "4K scope 24 fps (4096x1716)"
+func (e Essence) String() string {
+	switch {
+	case e.Err != nil:
+		return e.Err.Error()
+	case e.Picture != nil:
+		return e.Picture.String()
+	case e.Sound != nil:
+		return e.Sound.String()
+	}
+	return ""
+}
+
+/*
+Essences reads the essence descriptor of every picture and sound MXF
+listed in the DCP's PKLs. Interop PKLs give the kind of essence in the mime
+type, but SMPTE PKLs only say application/mxf, so those assets are
+classified by the reels of the CPLs that use them
+*/
+func (dcp *DCP) Essences() []*Essence {
+	var essences []*Essence
+	roles := dcp.essenceRoles()
+	for _, pkl := range dcp.PKLs {
+		for _, asset := range pkl.Assets {
+			assetType := asset.Type
+			if assetType != MXFPictureAssetType && assetType != MXFSoundAssetType {
+				assetType = roles[asset.ID]
+			}
+			if assetType == MXFPictureAssetType || assetType == MXFSoundAssetType {
+				essences = append(essences, dcp.essence(asset, assetType))
+			}
+		}
+	}
+	return essences
+}
+
+// essenceRoles maps the ID of every picture and sound asset used in the
+// DCP's CPLs to its asset type
+func (dcp *DCP) essenceRoles() map[string]AssetType {
+	roles := make(map[string]AssetType)
+	for _, cpl := range dcp.CPLs {
+		for _, reel := range cpl.Reels {
+			if reel.Picture != nil {
+				roles[reel.Picture.ID] = MXFPictureAssetType
+			}
+			if reel.StereoscopicPicture != nil {
+				roles[reel.StereoscopicPicture.ID] = MXFPictureAssetType
+			}
+			if reel.Sound != nil {
+				roles[reel.Sound.ID] = MXFSoundAssetType
+			}
+		}
+	}
+	return roles
+}
+
+// essence resolves a PKL asset through the asset map and reads its descriptor
+func (dcp *DCP) essence(asset *PKLAsset, assetType AssetType) *Essence {
+	essence := &Essence{AssetID: asset.ID, Type: assetType}
+	amAsset := dcp.assetMapAsset(asset.ID)
+	essence.Path = firstPath(amAsset)
+	if essence.Path == "" {
+		essence.Err = errors.New("Asset " + asset.ID + " is not in the assetmap")
+		return essence
+	}
+	// The header partition is at the start of the first chunk
+	f, err := dcp.openChunk(amAsset.Chunks[0])
+	if err != nil {
+		essence.Err = err
+		return essence
+	}
+	defer f.Close()
+	file, err := parseMXF(f)
+	if err != nil {
+		essence.Err = err
+		return essence
+	}
+	if assetType == MXFPictureAssetType {
+		essence.Picture, err = file.PictureDescriptor()
+		if err == nil && essence.Picture == nil {
+			err = errors.New("No picture descriptor found in " + essence.Path)
+		}
+	} else {
+		essence.Sound, err = file.SoundDescriptor()
+		if err == nil && essence.Sound == nil {
+			err = errors.New("No sound descriptor found in " + essence.Path)
+		}
+	}
+	essence.Err = err
+	return essence
+}
+
+/*
+parseMXF reads the header metadata of an open MXF file. Files that can't
+seek, such as those in zip archives, are only read up to the end of their
+header metadata, which is all the descriptors need; essence is never read
+into memory. Files from tar archives had theirs parsed as the archive was
+read
+*/
+func parseMXF(file fs.File) (*mxf.File, error) {
+	switch f := file.(type) {
+	case *openTarFile:
+		return f.parseMXF()
+	case io.ReadSeeker:
+		return mxf.Parse(f)
+	case io.ReaderAt:
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return mxf.Parse(io.NewSectionReader(f, 0, info.Size()))
+	}
+	return mxf.ParseHeader(file)
+}
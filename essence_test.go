@@ -0,0 +1,162 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testPictureMXF is a picture MXF with a 4K scope RGBA descriptor and
+// header, body and footer partitions but no essence
+var testPictureMXF, _ = hex.DecodeString(strings.Join(strings.Fields(`
+060e2b34020501010d0102010102040083000068000100030000000100000000
+00000000000000000000000000000000000001be000000000000009400000000
+0000000000000000000000000000000000000001060e2b34040101020d010201
+100000000000000100000010060e2b34040101070d010301020c0100060e2b34
+020501010d010201010501008300001a00000001000000123c0a060e2b340101
+01010101150200000000060e2b340101010203010210010000008300000a0000
+0000000000000000060e2b34025301010d010101010129008300003430010008
+0000001800000001300200080000000000000030320300040000100032020004
+000006b4320e000800001000000006b4060e2b34020501010d01020101030400
+8300006800010003000000010000000000000110000000000000000000000000
+0000000000000000000000000000000000000000000000000000000000000000
+00000001060e2b34040101020d010201100000000000000100000010060e2b34
+040101070d010301020c0100060e2b340101010203010210010000008300001e
+000000000000000000000000000000000000000000000000000000000000060e
+2b34020501010d01020101040400830000680001000300000001000000000000
+01be000000000000011000000000000001be0000000000000000000000000000
+000000000000000000000000000000000001060e2b34040101020d0102011000
+00000000000100000010060e2b34040101070d010301020c0100060e2b340205
+01010d0102010111010083000028000000000000000000000000000000010000
+0000000001100000000000000000000001be0000003c
+`), ""))
+
+// testPictureEssence is testPictureMXF followed by n bytes standing in for
+// its essence
+func testPictureEssence(n int) []byte {
+	return append(append([]byte{}, testPictureMXF...), make([]byte, n)...)
+}
+
+// forwardFS hides the Seek and ReadAt methods of its files, like the file
+// systems of zip archives, and counts the bytes read from them
+type forwardFS struct {
+	fstest.MapFS
+	read int
+}
+
+type forwardFile struct {
+	fs.File
+	fsys *forwardFS
+}
+
+func (fsys *forwardFS) Open(name string) (fs.File, error) {
+	file, err := fsys.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return forwardFile{file, fsys}, nil
+}
+
+func (f forwardFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.fsys.read += n
+	return n, err
+}
+
+func TestEssencesErrors(t *testing.T) {
+	dir := writeTestDCP(t)
+	defer os.RemoveAll(dir)
+	dcp := &DCP{}
+	dcp.Validate(dir)
+	essences := dcp.Essences()
+	if len(essences) != 2 {
+		t.Fatalf("Essence count is incorrect: %d != %d", len(essences), 2)
+	}
+	// The test picture only has an MXF header prefix and the sound is missing
+	for _, essence := range essences {
+		if essence.Err == nil {
+			t.Errorf("Reading %s should fail", essence.Path)
+		}
+	}
+	if essences[0].Type != MXFPictureAssetType || essences[1].Type != MXFSoundAssetType {
+		t.Errorf("Essence types are incorrect: %d, %d", essences[0].Type, essences[1].Type)
+	}
+}
+
+func TestEssencesSMPTE(t *testing.T) {
+	dir := writeTestDCP(t)
+	defer os.RemoveAll(dir)
+	// SMPTE PKLs give every MXF the same mime type
+	pklXML := bytes.Replace(testPKLXML,
+		[]byte("http://www.digicine.com/PROTO-ASDCP-PKL-20040311#"),
+		[]byte(smptePKLNamespace), 1)
+	for _, kind := range []string{"Picture", "Sound"} {
+		pklXML = bytes.Replace(pklXML,
+			[]byte("application/x-smpte-mxf;asdcpKind="+kind),
+			[]byte("application/mxf"), 1)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pkl.xml"), pklXML, 0644); err != nil {
+		t.Fatalf("%s", err)
+	}
+	dcp := &DCP{}
+	dcp.Validate(dir)
+	if len(dcp.PKLs) != 1 || dcp.PKLs[0].Format != SMPTE {
+		t.Fatalf("The SMPTE PKL wasn't parsed")
+	}
+	essences := dcp.Essences()
+	if len(essences) != 2 {
+		t.Fatalf("Essence count is incorrect: %d != %d", len(essences), 2)
+	}
+	// The types come from the CPL reel
+	if essences[0].Type != MXFPictureAssetType || essences[1].Type != MXFSoundAssetType {
+		t.Errorf("Essence types are incorrect: %d, %d", essences[0].Type, essences[1].Type)
+	}
+	if essences[0].Path != "video.mxf" || essences[1].Path != "audio.mxf" {
+		t.Errorf("Essence paths are incorrect: %s, %s", essences[0].Path, essences[1].Path)
+	}
+}
+
+func TestEssencesForwardOnly(t *testing.T) {
+	fsys := &forwardFS{MapFS: fstest.MapFS{}}
+	for name, content := range testDCPFiles() {
+		fsys.MapFS[name] = &fstest.MapFile{Data: content}
+	}
+	essence := 1 << 20
+	fsys.MapFS["video.mxf"].Data = testPictureEssence(essence)
+	dcp := &DCP{}
+	dcp.ValidateFS(fsys, ".")
+	fsys.read = 0
+	essences := dcp.Essences()
+	if len(essences) != 2 || essences[0].Err != nil || essences[0].Picture == nil {
+		t.Fatalf("Picture essence is incorrect: %v", essences)
+	}
+	expected := "4K scope 24 fps (4096x1716)"
+	if essences[0].String() != expected {
+		t.Errorf("Picture summary is incorrect: %s != %s", essences[0].String(), expected)
+	}
+	// Only the header of the picture is read
+	if fsys.read >= essence {
+		t.Errorf("The whole picture was read: %d bytes", fsys.read)
+	}
+}
@@ -0,0 +1,60 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Loading DCPs from any file system, such as archives, embedded files or
+in-memory file systems
+*/
+
+package dcp
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// OpenFS builds a DCP from the directory root of fsys, which contains an
+// assetmap; it returns the first error found, use ValidateFS to find all
+func OpenFS(fsys fs.FS, root string) (*DCP, error) {
+	dcp := &DCP{}
+	sub, err := fs.Sub(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	dcp.load([]fs.FS{sub}, []string{root}, report)
+	if err := report.Err(); err != nil {
+		return nil, err
+	}
+	return dcp, nil
+}
+
+// ValidateFS is Validate for a DCP in the directory root of fsys
+func (dcp *DCP) ValidateFS(fsys fs.FS, root string) *Report {
+	sub, err := fs.Sub(fsys, root)
+	if err != nil {
+		report := &Report{}
+		report.Add(SeverityError, CodeAssetMapNotFound, root, "", err.Error())
+		return report
+	}
+	return dcp.validate([]fs.FS{sub}, []string{root})
+}
+
+// fsName converts an asset map chunk path, which may start with "/" or
+// "./", to a file name as used by fs.FS; the name can't escape the root
+func fsName(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
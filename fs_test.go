@@ -0,0 +1,85 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testDCPFS holds the test DCP in a subdirectory of an in-memory file system
+func testDCPFS() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, content := range testDCPFiles() {
+		fsys["dcps/test/"+name] = &fstest.MapFile{Data: content}
+	}
+	return fsys
+}
+
+func TestOpenFS(t *testing.T) {
+	fsys := testDCPFS()
+	// Fix the picture's size so that the DCP loads without errors
+	fsys["dcps/test/video.mxf"].Data = append(fsys["dcps/test/video.mxf"].Data, 0)
+	fsys["dcps/test/audio.mxf"] = &fstest.MapFile{Data: []byte{0}}
+	dcp, err := OpenFS(fsys, "dcps/test")
+	if err != nil {
+		t.Fatalf("Error opening DCP: %s", err)
+	}
+	if dcp.RootDir != "dcps/test" || len(dcp.CPLs) != 1 || len(dcp.PKLs) != 1 {
+		t.Errorf("DCP is incorrect: %s %d %d", dcp.RootDir, len(dcp.CPLs), len(dcp.PKLs))
+	}
+	results := dcp.VerifyHashes()
+	if len(results) == 0 || results[0].Err != nil {
+		t.Errorf("Hashes should be read from the file system: %+v", results)
+	}
+}
+
+func TestValidateFS(t *testing.T) {
+	report := (&DCP{}).ValidateFS(testDCPFS(), "dcps/test")
+	errs := report.Filter(SeverityError)
+	if len(errs) != 2 || errs[0].Code != CodeAssetSize || errs[1].Code != CodeAssetMissing {
+		t.Errorf("Errors are incorrect: %v", errs)
+	}
+	report = (&DCP{}).ValidateFS(testDCPFS(), "dcps/missing")
+	if len(report.Findings) != 1 || report.Findings[0].Code != CodeAssetMapNotFound {
+		t.Errorf("Missing directory should be reported: %v", report.Findings)
+	}
+}
+
+func TestParseCPLReader(t *testing.T) {
+	cpl, err := ParseCPLReader(strings.NewReader(string(testCPLXML)))
+	if err != nil {
+		t.Fatalf("Error parsing CPL: %s", err)
+	}
+	if cpl.ID != "urn:uuid:d65572db-2e09-4745-817d-a2881222e2db" {
+		t.Errorf("CPL ID is incorrect: %s", cpl.ID)
+	}
+}
+
+func TestFSName(t *testing.T) {
+	for in, out := range map[string]string{
+		"video.mxf":     "video.mxf",
+		"./video.mxf":   "video.mxf",
+		"/reel/a.mxf":   "reel/a.mxf",
+		"reel//b.mxf":   "reel/b.mxf",
+		"../escape.mxf": "escape.mxf",
+	} {
+		if name := fsName(in); name != out {
+			t.Errorf("fsName(%s) is incorrect: %s != %s", in, name, out)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Hash verification of the assets listed in a DCP's packing lists
+*/
+
+package dcp
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// HashResult is the outcome of checking a single PKL asset's hash
+type HashResult struct {
+	AssetID  string
+	PKLID    string
+	Path     string // path of the asset relative to the DCP root
+	Expected string // Base64 SHA-1 listed in the PKL
+	Actual   string // Base64 SHA-1 of the file; empty if it couldn't be read
+	Err      error  // set if the asset couldn't be located or read
+}
+
+// OK reports whether the asset's file matches the hash in the PKL
+func (hr HashResult) OK() bool {
+	return hr.Err == nil && hr.Actual == hr.Expected
+}
+
+// Message describes the outcome of the check
+func (hr HashResult) Message() string {
+	switch {
+	case hr.Err != nil:
+		return hr.Err.Error()
+	case hr.OK():
+		return "hash is correct"
+	}
+	return "hash is " + hr.Actual + ", expected " + hr.Expected
+}
+
+// CodeAssetHash is reported for assets that don't match their PKL hash
+const CodeAssetHash Code = "ASSET_HASH_MISMATCH"
+
+// CheckHashes adds a finding to the report for each asset that doesn't
+// match its PKL hash; it isn't run by Validate since it reads every asset
+func CheckHashes(dcp *DCP, report *Report) {
+	for _, result := range dcp.VerifyHashes() {
+		if !result.OK() {
+			report.Add(SeverityError, CodeAssetHash, result.Path, result.AssetID,
+				result.Message())
+		}
+	}
+}
+
+// VerifyHashes checks every asset listed in the DCP's PKLs against its file
+func (dcp *DCP) VerifyHashes() []*HashResult {
+	var results []*HashResult
+	for _, pkl := range dcp.PKLs {
+		for _, asset := range pkl.Assets {
+			results = append(results, dcp.verifyHash(pkl, asset))
+		}
+	}
+	return results
+}
+
+// verifyHash resolves a PKL asset through the asset map and hashes its file
+func (dcp *DCP) verifyHash(pkl *PKL, asset *PKLAsset) *HashResult {
+	result := &HashResult{
+		AssetID:  asset.ID,
+		PKLID:    pkl.ID,
+		Expected: asset.Hash}
+	amAsset := dcp.AssetMap.Asset(asset.ID)
+	if amAsset == nil || len(amAsset.Chunks) == 0 {
+		result.Err = errors.New("Asset " + asset.ID + " is not in the assetmap")
+		return result
+	}
+	result.Path = amAsset.Chunks[0].Path
+	// Files streamed from an archive were hashed as they were read
+	chunk := amAsset.Chunks[0]
+	if hash, ok := dcp.hashes[fsName(chunk.Path)]; ok &&
+		len(amAsset.Chunks) == 1 && chunk.Volume() == 1 {
+		result.Actual = hash
+		return result
+	}
+	r, err := dcp.AssetReader(amAsset)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer r.Close()
+	result.Actual, result.Err = hashReader(r)
+	return result
+}
+
+// hashReader streams r through SHA-1 and returns the Base64 encoded digest,
+// which is how hashes are written in a PKL
+func hashReader(r io.Reader) (string, error) {
+	h := sha1.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,89 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeHashDCP writes two small assets to a temporary directory and returns
+// a DCP whose PKL lists one correct and one incorrect hash
+func makeHashDCP(t *testing.T) *DCP {
+	dir, err := ioutil.TempDir("", "dcp")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	files := map[string]string{
+		"good.mxf": "hello world",
+		"bad.mxf":  "tampered",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	return &DCP{
+		RootDir: dir,
+		AssetMap: &AssetMap{Assets: []*AMAsset{
+			{ID: "urn:uuid:good", Chunks: []*Chunk{{Path: "good.mxf", Size: 11}}},
+			{ID: "urn:uuid:bad", Chunks: []*Chunk{{Path: "bad.mxf", Size: 8}}},
+		}},
+		PKLs: []*PKL{{ID: "urn:uuid:pkl", Assets: []*PKLAsset{
+			// SHA-1 of "hello world"
+			{ID: "urn:uuid:good", Hash: "Kq5sNclPz7QV2+lfQIuc6R7oRu0="},
+			{ID: "urn:uuid:bad", Hash: "Kq5sNclPz7QV2+lfQIuc6R7oRu0="},
+			{ID: "urn:uuid:missing", Hash: "Kq5sNclPz7QV2+lfQIuc6R7oRu0="},
+		}}},
+	}
+}
+
+func TestVerifyHashes(t *testing.T) {
+	dcp := makeHashDCP(t)
+	defer os.RemoveAll(dcp.RootDir)
+	results := dcp.VerifyHashes()
+	if len(results) != 3 {
+		t.Fatalf("Result count is incorrect: %d != %d", len(results), 3)
+	}
+	if !results[0].OK() {
+		t.Errorf("Hash of %s should match: %s != %s",
+			results[0].Path, results[0].Actual, results[0].Expected)
+	}
+	if results[1].OK() || results[1].Err != nil {
+		t.Errorf("Hash of %s should mismatch without an error", results[1].Path)
+	}
+	if results[2].OK() || results[2].Err == nil {
+		t.Errorf("Asset missing from the assetmap should fail with an error")
+	}
+	if results[0].PKLID != "urn:uuid:pkl" {
+		t.Errorf("PKL id is incorrect: %s != %s", results[0].PKLID, "urn:uuid:pkl")
+	}
+}
+
+func TestCheckHashes(t *testing.T) {
+	dcp := makeHashDCP(t)
+	defer os.RemoveAll(dcp.RootDir)
+	report := &Report{}
+	CheckHashes(dcp, report)
+	if len(report.Findings) != 2 {
+		t.Fatalf("Finding count is incorrect: %d != %d", len(report.Findings), 2)
+	}
+	if report.Findings[0].Code != CodeAssetHash || report.Findings[0].File != "bad.mxf" {
+		t.Errorf("Finding is incorrect: %s %s", report.Findings[0].Code, report.Findings[0].File)
+	}
+}
@@ -0,0 +1,139 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+JSON representation of a DCP; the layout is described by the JSON schema in
+schema/dcp.schema.json and versioned by JSONSchemaVersion
+*/
+
+package dcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSONSchemaVersion is the version of the JSON layout produced by
+// DCP.MarshalJSON; it changes whenever the layout changes incompatibly
+const JSONSchemaVersion = 1
+
+// dcpJSON is the top level JSON document; used internally only
+type dcpJSON struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	RootDir       string    `json:"rootDir"`
+	AssetMap      *AssetMap `json:"assetMap"`
+	CPLs          []*CPL    `json:"cpls"`
+	PKLs          []*PKL    `json:"pkls"`
+}
+
+// MarshalJSON produces the DCP's JSON document, tagged with the schema version
+func (dcp *DCP) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&dcpJSON{
+		SchemaVersion: JSONSchemaVersion,
+		RootDir:       dcp.RootDir,
+		AssetMap:      dcp.AssetMap,
+		CPLs:          dcp.CPLs,
+		PKLs:          dcp.PKLs})
+}
+
+// UnmarshalJSON reads a DCP's JSON document, which must be of the current
+// schema version
+func (dcp *DCP) UnmarshalJSON(data []byte) error {
+	var dJSON dcpJSON
+	if err := json.Unmarshal(data, &dJSON); err != nil {
+		return err
+	}
+	if dJSON.SchemaVersion != JSONSchemaVersion {
+		return fmt.Errorf("Unsupported JSON schema version: %d", dJSON.SchemaVersion)
+	}
+	dcp.RootDir = dJSON.RootDir
+	dcp.AssetMap = dJSON.AssetMap
+	dcp.CPLs = dJSON.CPLs
+	dcp.PKLs = dJSON.PKLs
+	return nil
+}
+
+// MarshalJSON renders the format as "interop", "smpte" or "unknown"
+func (f Format) MarshalJSON() ([]byte, error) {
+	return marshalEnum(f)
+}
+
+// UnmarshalJSON reads a format rendered by MarshalJSON
+func (f *Format) UnmarshalJSON(data []byte) error {
+	i, err := unmarshalEnum(data, "format", int(SMPTE)+1,
+		func(i int) fmt.Stringer { return Format(i) })
+	*f = Format(i)
+	return err
+}
+
+// MarshalJSON renders the asset type as its lower case name, e.g. "picture"
+func (t AssetType) MarshalJSON() ([]byte, error) {
+	return marshalEnum(t)
+}
+
+// UnmarshalJSON reads an asset type rendered by MarshalJSON
+func (t *AssetType) UnmarshalJSON(data []byte) error {
+	i, err := unmarshalEnum(data, "asset type", int(MXFSoundAssetType)+1,
+		func(i int) fmt.Stringer { return AssetType(i) })
+	*t = AssetType(i)
+	return err
+}
+
+// MarshalJSON renders the content kind as it's written in a CPL
+func (kind ContentKind) MarshalJSON() ([]byte, error) {
+	return marshalEnum(kind)
+}
+
+// UnmarshalJSON reads a content kind rendered by MarshalJSON
+func (kind *ContentKind) UnmarshalJSON(data []byte) error {
+	i, err := unmarshalEnum(data, "content kind", len(contentKindNames),
+		func(i int) fmt.Stringer { return ContentKind(i) })
+	*kind = ContentKind(i)
+	return err
+}
+
+// MarshalJSON renders the severity as "info", "warning" or "error"
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return marshalEnum(s)
+}
+
+// UnmarshalJSON reads a severity rendered by MarshalJSON
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	i, err := unmarshalEnum(data, "severity", int(SeverityError)+1,
+		func(i int) fmt.Stringer { return Severity(i) })
+	*s = Severity(i)
+	return err
+}
+
+// marshalEnum renders an enum value as its lower case name
+func marshalEnum(v fmt.Stringer) ([]byte, error) {
+	return json.Marshal(strings.ToLower(v.String()))
+}
+
+// unmarshalEnum finds the enum value, among the n values from 0, whose
+// name matches the JSON string
+func unmarshalEnum(data []byte, kind string, n int, value func(int) fmt.Stringer) (int, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return 0, err
+	}
+	for i := 0; i < n; i++ {
+		if strings.EqualFold(value(i).String(), name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown %s: %s", kind, name)
+}
@@ -0,0 +1,77 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDCPJSON(t *testing.T) {
+	dcp := &DCP{
+		RootDir:  "/dcp",
+		AssetMap: parseAM(t),
+		CPLs:     []*CPL{parseCPL(t)},
+		PKLs:     []*PKL{parsePKL(t)}}
+	data, err := json.Marshal(dcp)
+	if err != nil {
+		t.Fatalf("Error marshalling JSON: %s", err)
+	}
+	for _, s := range []string{`"schemaVersion":1`, `"format":"interop"`,
+		`"contentKind":"test"`, `"type":"picture"`} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("JSON doesn't contain %s", s)
+		}
+	}
+	parsed := &DCP{}
+	if err := json.Unmarshal(data, parsed); err != nil {
+		t.Fatalf("Error unmarshalling JSON: %s", err)
+	}
+	if parsed.CPLs[0].ContentKind != ContentKindTest || parsed.Format() != INTEROP {
+		t.Errorf("Enums are incorrect after a JSON round trip: %s %s",
+			parsed.CPLs[0].ContentKind, parsed.Format())
+	}
+	remarshalled, err := json.Marshal(parsed)
+	if err != nil {
+		t.Fatalf("Error marshalling JSON: %s", err)
+	}
+	if string(remarshalled) != string(data) {
+		t.Errorf("JSON is incorrect after a round trip: %s != %s", remarshalled, data)
+	}
+}
+
+func TestDCPJSONVersion(t *testing.T) {
+	err := json.Unmarshal([]byte(`{"schemaVersion":2}`), &DCP{})
+	if err == nil {
+		t.Error("Unsupported schema version unmarshalled")
+	}
+}
+
+func TestEnumJSON(t *testing.T) {
+	var f Format
+	if err := json.Unmarshal([]byte(`"smpte"`), &f); err != nil || f != SMPTE {
+		t.Errorf("Format is incorrect: %s != SMPTE (%v)", f, err)
+	}
+	var s Severity
+	if err := json.Unmarshal([]byte(`"warning"`), &s); err != nil || s != SeverityWarning {
+		t.Errorf("Severity is incorrect: %s != warning (%v)", s, err)
+	}
+	var a AssetType
+	if err := json.Unmarshal([]byte(`"video"`), &a); err == nil {
+		t.Error("Unknown asset type unmarshalled")
+	}
+}
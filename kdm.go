@@ -0,0 +1,242 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+KDM struct and associated functions
+http://en.wikipedia.org/wiki/Key_Delivery_Message
+*/
+
+package dcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/googlesamples/dcp/xmldsig"
+)
+
+// KDM is a Key Delivery Message (SMPTE ST 430-1), carrying the content keys
+// of an encrypted CPL for one recipient
+type KDM struct {
+	MessageID        string
+	AnnotationText   string
+	IssueDate        time.Time
+	Signer           *Signer
+	Recipient        *Recipient
+	CPLID            string
+	ContentTitleText string
+	NotValidBefore   time.Time
+	NotValidAfter    time.Time
+	KeyIDs           []*TypedKeyID
+	CipherValues     [][]byte // RSA-OAEP encrypted content key blocks
+
+	raw []byte // XML document the KDM was parsed from
+}
+
+// Recipient identifies the certificate the content keys are encrypted for
+type Recipient struct {
+	IssuerName   string `xml:"X509IssuerSerial>X509IssuerName"`
+	SerialNumber string `xml:"X509IssuerSerial>X509SerialNumber"`
+	SubjectName  string `xml:"X509SubjectName"`
+}
+
+// TypedKeyID is a content key ID with the type of essence it decrypts
+type TypedKeyID struct {
+	KeyType string // e.g. MDIK for picture, MDAK for sound
+	KeyID   string `xml:"KeyId"`
+}
+
+// ContentKey is a decrypted content key
+type ContentKey struct {
+	KeyType          string // empty for Interop KDMs
+	KeyID            string
+	CPLID            string
+	NotValidBefore   time.Time
+	NotValidAfter    time.Time
+	Key              []byte // AES-128 key
+	SignerThumbprint []byte // SHA-1 of the KDM signer's certificate
+}
+
+// smpteKeyStructureID starts each SMPTE key block
+var smpteKeyStructureID = []byte{0xf1, 0xdc, 0x12, 0x44, 0x60, 0x16, 0x9a, 0x0e,
+	0x85, 0xbc, 0x30, 0x06, 0x42, 0xf8, 0x66, 0xab}
+
+// Sizes of the decrypted key blocks
+const (
+	smpteKeyBlockSize   = 138
+	interopKeyBlockSize = 134
+)
+
+// ParseKDMFile parses a KDM XML file, whose file path is filename
+func ParseKDMFile(filename string) (*KDM, error) {
+	xmlStr, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKDM(xmlStr)
+}
+
+// ParseKDMReader parses a KDM XML document read from r
+func ParseKDMReader(r io.Reader) (*KDM, error) {
+	xmlStr, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKDM(xmlStr)
+}
+
+// ParseKDM parses a KDM XML string
+func ParseKDM(xmlStr []byte) (*KDM, error) {
+	var kdmXML kdmXML
+	if err := xml.Unmarshal(xmlStr, &kdmXML); err != nil {
+		return nil, err
+	}
+	public := kdmXML.AuthenticatedPublic
+	ext := public.Extensions
+	kdm := &KDM{
+		MessageID:      public.MessageID,
+		AnnotationText: public.AnnotationText,
+		IssueDate:      public.IssueDate,
+		Signer: &Signer{
+			IssuerName:   public.Signer.IssuerName,
+			SerialNumber: public.Signer.SerialNumber},
+		Recipient:        ext.Recipient,
+		CPLID:            ext.CPLID,
+		ContentTitleText: ext.ContentTitleText,
+		NotValidBefore:   ext.NotValidBefore,
+		NotValidAfter:    ext.NotValidAfter,
+		KeyIDs:           ext.KeyIDs,
+		raw:              xmlStr}
+	for _, value := range kdmXML.CipherValues {
+		cipherValue, err := base64.StdEncoding.DecodeString(
+			strings.Join(strings.Fields(value), ""))
+		if err != nil {
+			return nil, err
+		}
+		kdm.CipherValues = append(kdm.CipherValues, cipherValue)
+	}
+	return kdm, nil
+}
+
+/*
+kdmXML is used to unmarshall XML; used internally only - KDM struct
+is passed back by ParseKDM() & ParseKDMFile()
+*/
+type kdmXML struct {
+	AuthenticatedPublic struct {
+		MessageID      string `xml:"MessageId"`
+		AnnotationText string
+		IssueDate      time.Time
+		Signer         struct {
+			IssuerName   string `xml:"X509IssuerName"`
+			SerialNumber string `xml:"X509SerialNumber"`
+		}
+		Extensions struct {
+			Recipient        *Recipient
+			CPLID            string `xml:"CompositionPlaylistId"`
+			ContentTitleText string
+			NotValidBefore   time.Time     `xml:"ContentKeysNotValidBefore"`
+			NotValidAfter    time.Time     `xml:"ContentKeysNotValidAfter"`
+			KeyIDs           []*TypedKeyID `xml:"KeyIdList>TypedKeyId"`
+		} `xml:"RequiredExtensions>KDMRequiredExtensions"`
+	}
+	CipherValues []string `xml:"AuthenticatedPrivate>EncryptedKey>CipherData>CipherValue"`
+}
+
+// IsValidAt checks if the content keys may be used at the given time
+func (kdm KDM) IsValidAt(t time.Time) bool {
+	return !t.Before(kdm.NotValidBefore) && !t.After(kdm.NotValidAfter)
+}
+
+// VerifySignature checks the KDM's enveloped signature as CPL's
+// VerifySignature does; KDMs sign their AuthenticatedPublic and
+// AuthenticatedPrivate parts rather than the whole document, and both must
+// be signed, or the keys and their validity could be changed
+func (kdm *KDM) VerifySignature(roots *x509.CertPool) ([]*x509.Certificate, error) {
+	verify := func(doc []byte, opts xmldsig.Options) ([]*x509.Certificate, error) {
+		return xmldsig.VerifyElements(doc, opts, "AuthenticatedPublic", "AuthenticatedPrivate")
+	}
+	return verifySignature(verify, kdm.raw, kdm.Signer,
+		xmldsig.Options{Roots: roots, Time: kdm.IssueDate})
+}
+
+// DecryptKeys decrypts the content keys with the recipient's private key
+func (kdm *KDM) DecryptKeys(key *rsa.PrivateKey) ([]*ContentKey, error) {
+	var keys []*ContentKey
+	for _, cipherValue := range kdm.CipherValues {
+		block, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, cipherValue, nil)
+		if err != nil {
+			return nil, err
+		}
+		contentKey, err := parseKeyBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if contentKey.CPLID != kdm.CPLID {
+			return nil, errors.New("Content key " + contentKey.KeyID +
+				" is for CPL " + contentKey.CPLID + ", not " + kdm.CPLID)
+		}
+		keys = append(keys, contentKey)
+	}
+	return keys, nil
+}
+
+// parseKeyBlock splits a decrypted key block into its fields; Interop
+// blocks have no key type
+func parseKeyBlock(block []byte) (*ContentKey, error) {
+	switch len(block) {
+	case smpteKeyBlockSize:
+		if !bytes.Equal(block[:16], smpteKeyStructureID) {
+			return nil, errors.New("Key block structure ID is incorrect")
+		}
+	case interopKeyBlockSize:
+	default:
+		return nil, fmt.Errorf("Key block size is incorrect: %d", len(block))
+	}
+	key := &ContentKey{SignerThumbprint: block[16:36], CPLID: formatUUID(block[36:52])}
+	rest := block[52:]
+	if len(block) == smpteKeyBlockSize {
+		key.KeyType = string(rest[:4])
+		rest = rest[4:]
+	}
+	key.KeyID = formatUUID(rest[:16])
+	var err error
+	if key.NotValidBefore, err = time.Parse(time.RFC3339, string(rest[16:41])); err != nil {
+		return nil, err
+	}
+	if key.NotValidAfter, err = time.Parse(time.RFC3339, string(rest[41:66])); err != nil {
+		return nil, err
+	}
+	key.Key = rest[66:82]
+	return key, nil
+}
+
+// formatUUID writes 16 bytes as a urn:uuid, the form IDs take in DCP XML
+func formatUUID(b []byte) string {
+	h := hex.EncodeToString(b)
+	return "urn:uuid:" + h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
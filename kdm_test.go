@@ -0,0 +1,180 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/googlesamples/dcp/xmldsig"
+)
+
+// testKDMXML is a KDM template, without a signature; the encrypted key
+// blocks replace %s
+var testKDMXML = `<?xml version="1.0" encoding="UTF-8"?>
+<DCinemaSecurityMessage xmlns="http://www.smpte-ra.org/schemas/430-3/2006/ETM" xmlns:dsig="http://www.w3.org/2000/09/xmldsig#" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">
+  <AuthenticatedPublic Id="ID_AuthenticatedPublic">
+    <MessageId>urn:uuid:8e4d0a7f-5d86-4c09-9d5a-0b3b8ab4b1f3</MessageId>
+    <MessageType>http://www.smpte-ra.org/430-1/2006/KDM#kdm-key-type</MessageType>
+    <AnnotationText>Encrypted Test KDM</AnnotationText>
+    <IssueDate>2015-06-01T10:00:00+00:00</IssueDate>
+    <Signer>
+      <dsig:X509IssuerName>CN=root.example.com</dsig:X509IssuerName>
+      <dsig:X509SerialNumber>2</dsig:X509SerialNumber>
+    </Signer>
+    <RequiredExtensions>
+      <KDMRequiredExtensions xmlns="http://www.smpte-ra.org/schemas/430-1/2006/KDM">
+        <Recipient>
+          <X509IssuerSerial>
+            <dsig:X509IssuerName>CN=root.example.com</dsig:X509IssuerName>
+            <dsig:X509SerialNumber>7</dsig:X509SerialNumber>
+          </X509IssuerSerial>
+          <X509SubjectName>CN=SM.projector.example.com</X509SubjectName>
+        </Recipient>
+        <CompositionPlaylistId>urn:uuid:b5d2a0bd-ec5a-4bd9-9d1e-cbd5c1f2b5b4</CompositionPlaylistId>
+        <ContentTitleText>Encrypted Test</ContentTitleText>
+        <ContentKeysNotValidBefore>2015-06-01T00:00:00+00:00</ContentKeysNotValidBefore>
+        <ContentKeysNotValidAfter>2015-06-08T00:00:00+00:00</ContentKeysNotValidAfter>
+        <KeyIdList>
+          <TypedKeyId>
+            <KeyType scope="http://www.smpte-ra.org/430-1/2006/KDM#kdm-key-type">MDIK</KeyType>
+            <KeyId>urn:uuid:00112233-4455-6677-8899-aabbccddeeff</KeyId>
+          </TypedKeyId>
+        </KeyIdList>
+      </KDMRequiredExtensions>
+    </RequiredExtensions>
+    <NonCriticalExtensions/>
+  </AuthenticatedPublic>
+  <AuthenticatedPrivate Id="ID_AuthenticatedPrivate">%s
+  </AuthenticatedPrivate>
+</DCinemaSecurityMessage>`
+
+// testContentKey is the AES key carried by the test KDM
+var testContentKey = []byte("0123456789abcdef")
+
+// makeKeyBlock builds a SMPTE key block for the test KDM
+func makeKeyBlock(cplID []byte) []byte {
+	var b bytes.Buffer
+	b.Write(smpteKeyStructureID)
+	b.Write(make([]byte, 20))
+	b.Write(cplID)
+	b.WriteString("MDIK")
+	b.Write([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77,
+		0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	b.WriteString("2015-06-01T00:00:00+00:00")
+	b.WriteString("2015-06-08T00:00:00+00:00")
+	b.Write(testContentKey)
+	return b.Bytes()
+}
+
+// makeKDM encrypts key blocks for the recipient key into the test KDM
+func makeKDM(t *testing.T, key *rsa.PrivateKey, blocks ...[]byte) []byte {
+	var encrypted string
+	for _, block := range blocks {
+		cipherValue, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &key.PublicKey, block, nil)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		encrypted += `
+    <enc:EncryptedKey>
+      <enc:EncryptionMethod Algorithm="http://www.w3.org/2001/04/xmlenc#rsa-oaep-mgf1p"/>
+      <enc:CipherData>
+        <enc:CipherValue>` + base64.StdEncoding.EncodeToString(cipherValue) + `</enc:CipherValue>
+      </enc:CipherData>
+    </enc:EncryptedKey>`
+	}
+	return []byte(fmt.Sprintf(testKDMXML, encrypted))
+}
+
+var testKDMCPLID = []byte{0xb5, 0xd2, 0xa0, 0xbd, 0xec, 0x5a, 0x4b, 0xd9,
+	0x9d, 0x1e, 0xcb, 0xd5, 0xc1, 0xf2, 0xb5, 0xb4}
+
+func TestKDM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	kdm, err := ParseKDM(makeKDM(t, key, makeKeyBlock(testKDMCPLID)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	expectedID := "urn:uuid:b5d2a0bd-ec5a-4bd9-9d1e-cbd5c1f2b5b4"
+	if kdm.CPLID != expectedID {
+		t.Errorf("CPL id is incorrect: %s != %s", kdm.CPLID, expectedID)
+	}
+	if kdm.ContentTitleText != "Encrypted Test" {
+		t.Errorf("ContentTitleText is incorrect: %s", kdm.ContentTitleText)
+	}
+	if kdm.Recipient == nil || kdm.Recipient.SerialNumber != "7" ||
+		kdm.Recipient.SubjectName != "CN=SM.projector.example.com" {
+		t.Errorf("Recipient is incorrect: %+v", kdm.Recipient)
+	}
+	if kdm.Signer == nil {
+		t.Errorf("Signer is missing")
+	}
+	if len(kdm.KeyIDs) != 1 || kdm.KeyIDs[0].KeyType != "MDIK" ||
+		kdm.KeyIDs[0].KeyID != "urn:uuid:00112233-4455-6677-8899-aabbccddeeff" {
+		t.Errorf("Key ids are incorrect: %+v", kdm.KeyIDs)
+	}
+	if !kdm.IsValidAt(time.Date(2015, 6, 3, 0, 0, 0, 0, time.UTC)) ||
+		kdm.IsValidAt(time.Date(2015, 6, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Validity window is incorrect: %s - %s", kdm.NotValidBefore, kdm.NotValidAfter)
+	}
+	if _, err := kdm.VerifySignature(nil); err != xmldsig.ErrUnsigned {
+		t.Errorf("Unsigned KDM should return ErrUnsigned: %v", err)
+	}
+	keys, err := kdm.DecryptKeys(key)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("Key count is incorrect: %d != %d", len(keys), 1)
+	}
+	if keys[0].KeyID != kdm.KeyIDs[0].KeyID || keys[0].KeyType != "MDIK" ||
+		!bytes.Equal(keys[0].Key, testContentKey) {
+		t.Errorf("Content key is incorrect: %+v", keys[0])
+	}
+	if !keys[0].NotValidAfter.Equal(kdm.NotValidAfter) {
+		t.Errorf("Key validity is incorrect: %s != %s", keys[0].NotValidAfter, kdm.NotValidAfter)
+	}
+}
+
+func TestKDMWrongCPL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	kdm, err := ParseKDM(makeKDM(t, key, makeKeyBlock(make([]byte, 16))))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := kdm.DecryptKeys(key); err == nil {
+		t.Errorf("Key block for another CPL should be rejected")
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := kdm.DecryptKeys(other); err == nil {
+		t.Errorf("Decrypting with the wrong private key should fail")
+	}
+}
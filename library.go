@@ -0,0 +1,207 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Libraries of DCPs, such as a server's content store, found by walking a
+directory tree for assetmaps and indexed by CPL, PKL and asset ID
+*/
+
+package dcp
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Library is an index of the DCPs found under a root directory
+type Library struct {
+	Root    string
+	Entries []*LibraryEntry // in order of Dir
+
+	cpls   map[string]*LibraryEntry
+	pkls   map[string]*LibraryEntry
+	assets map[string][]*LibraryEntry
+}
+
+// LibraryEntry is a DCP found in a library, with the problems found loading
+// it; a broken DCP is listed with its report, and indexed as far as it loaded
+type LibraryEntry struct {
+	Dir    string // directory holding the assetmap, relative to the library root
+	DCP    *DCP   // nil if its assetmap couldn't be read
+	Report *Report
+}
+
+/*
+ScanLibrary walks the directory tree under root for assetmaps and loads the
+DCPs found, using up to workers goroutines or, if workers is 0, one per CPU;
+it only fails if root can't be read
+*/
+func ScanLibrary(root string, workers int) (*Library, error) {
+	return scanLibrary(os.DirFS(root), root, workers, func(dir string) (*DCP, *Report) {
+		dcp := &DCP{}
+		return dcp, dcp.Validate(filepath.Join(root, filepath.FromSlash(dir)))
+	})
+}
+
+// ScanLibraryFS is ScanLibrary for a library at the root of fsys
+func ScanLibraryFS(fsys fs.FS, workers int) (*Library, error) {
+	return scanLibrary(fsys, ".", workers, func(dir string) (*DCP, *Report) {
+		dcp := &DCP{}
+		return dcp, dcp.ValidateFS(fsys, dir)
+	})
+}
+
+// scanLibrary finds the DCPs in fsys and loads each with load, on a pool of
+// workers
+func scanLibrary(fsys fs.FS, root string, workers int,
+	load func(dir string) (*DCP, *Report)) (*Library, error) {
+	dirs, err := findDCPDirs(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	lib := &Library{Root: root, Entries: make([]*LibraryEntry, len(dirs))}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				dcp, report := load(dirs[i])
+				if dcp.AssetMap == nil {
+					dcp = nil
+				}
+				lib.Entries[i] = &LibraryEntry{dirs[i], dcp, report}
+			}
+		}()
+	}
+	for i := range dirs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	lib.index()
+	return lib, nil
+}
+
+// findDCPDirs returns the sorted directories of fsys holding an assetmap;
+// directories that can't be read, other than the root, are skipped
+func findDCPDirs(fsys fs.FS) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name == "." {
+				return err
+			}
+			return fs.SkipDir
+		}
+		if !d.IsDir() && assetMapRegExp.MatchString(d.Name()) {
+			// A DCP may have both an ASSETMAP and an ASSETMAP.xml
+			if dir := path.Dir(name); !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// index adds the CPLs, PKLs and assets of the library's DCPs to its maps;
+// the first DCP holding a CPL or PKL is the one indexed
+func (lib *Library) index() {
+	lib.cpls = map[string]*LibraryEntry{}
+	lib.pkls = map[string]*LibraryEntry{}
+	lib.assets = map[string][]*LibraryEntry{}
+	for _, entry := range lib.Entries {
+		if entry.DCP == nil {
+			continue
+		}
+		for _, cpl := range entry.DCP.CPLs {
+			if lib.cpls[cpl.ID] == nil {
+				lib.cpls[cpl.ID] = entry
+			}
+		}
+		for _, pkl := range entry.DCP.PKLs {
+			if lib.pkls[pkl.ID] == nil {
+				lib.pkls[pkl.ID] = entry
+			}
+		}
+		for _, asset := range entry.DCP.AssetMap.Assets {
+			lib.assets[asset.ID] = append(lib.assets[asset.ID], entry)
+		}
+	}
+}
+
+// CPL returns the CPL with the given ID and the entry of the DCP holding
+// it, or nil if it isn't in the library
+func (lib *Library) CPL(id string) (*CPL, *LibraryEntry) {
+	entry := lib.cpls[id]
+	if entry == nil {
+		return nil, nil
+	}
+	for _, cpl := range entry.DCP.CPLs {
+		if cpl.ID == id {
+			return cpl, entry
+		}
+	}
+	return nil, nil
+}
+
+// PKL returns the PKL with the given ID and the entry of the DCP holding
+// it, or nil if it isn't in the library
+func (lib *Library) PKL(id string) (*PKL, *LibraryEntry) {
+	entry := lib.pkls[id]
+	if entry == nil {
+		return nil, nil
+	}
+	for _, pkl := range entry.DCP.PKLs {
+		if pkl.ID == id {
+			return pkl, entry
+		}
+	}
+	return nil, nil
+}
+
+// Asset returns the entries of every DCP whose assetmap lists the asset
+// with the given ID; an OV's assets may also be listed by copies of it
+func (lib *Library) Asset(id string) []*LibraryEntry {
+	return lib.assets[id]
+}
+
+// DCPs returns the DCPs of the library that loaded, such as to give as the
+// candidate OVs of a VF
+func (lib *Library) DCPs() []*DCP {
+	var dcps []*DCP
+	for _, entry := range lib.Entries {
+		if entry.DCP != nil {
+			dcps = append(dcps, entry.DCP)
+		}
+	}
+	return dcps
+}
@@ -0,0 +1,100 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// testLibraryFS holds the test DCP twice, once nested deeper, and a DCP
+// whose assetmap is broken
+func testLibraryFS() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, content := range testDCPFiles() {
+		fsys["features/a/"+name] = &fstest.MapFile{Data: content}
+		fsys["trailers/2015/b/"+name] = &fstest.MapFile{Data: content}
+	}
+	fsys["broken/ASSETMAP.xml"] = &fstest.MapFile{Data: []byte("<AssetMap")}
+	fsys["empty/readme.txt"] = &fstest.MapFile{Data: []byte("Not a DCP")}
+	return fsys
+}
+
+func TestScanLibraryFS(t *testing.T) {
+	lib, err := ScanLibraryFS(testLibraryFS(), 2)
+	if err != nil {
+		t.Fatalf("Error scanning library: %s", err)
+	}
+	var dirs []string
+	for _, entry := range lib.Entries {
+		dirs = append(dirs, entry.Dir)
+	}
+	if len(dirs) != 3 || dirs[0] != "broken" || dirs[1] != "features/a" ||
+		dirs[2] != "trailers/2015/b" {
+		t.Fatalf("Library entries are incorrect: %v", dirs)
+	}
+	broken := lib.Entries[0]
+	if broken.DCP != nil || broken.Report.Err() == nil {
+		t.Errorf("Broken DCP should be listed with its errors")
+	}
+	if len(lib.DCPs()) != 2 {
+		t.Errorf("DCP count is incorrect: %d != 2", len(lib.DCPs()))
+	}
+	cpl, entry := lib.CPL("urn:uuid:d65572db-2e09-4745-817d-a2881222e2db")
+	if cpl == nil || entry != lib.Entries[1] {
+		t.Errorf("CPL should be found in the first DCP holding it")
+	}
+	if pkl, _ := lib.PKL("urn:uuid:4d9e98c3-c923-4910-ae0e-9f5951c9cc5f"); pkl == nil {
+		t.Errorf("PKL should be found")
+	}
+	if entries := lib.Asset("urn:uuid:db95199c-0e2f-4ac4-9e54-b97919dcdf07"); len(entries) != 2 {
+		t.Errorf("Asset should be found in both DCPs: %d", len(entries))
+	}
+	if cpl, entry := lib.CPL("urn:uuid:00000000-0000-0000-0000-000000000000"); cpl != nil || entry != nil {
+		t.Errorf("Unknown CPL found")
+	}
+}
+
+func TestScanLibrary(t *testing.T) {
+	root, err := ioutil.TempDir("", "library")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "features", "a")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("%s", err)
+	}
+	for name, content := range testDCPFiles() {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	lib, err := ScanLibrary(root, 0)
+	if err != nil {
+		t.Fatalf("Error scanning library: %s", err)
+	}
+	if len(lib.Entries) != 1 || lib.Entries[0].Dir != "features/a" ||
+		lib.Entries[0].DCP == nil || lib.Entries[0].DCP.RootDir != dir {
+		t.Fatalf("Library entries are incorrect: %+v", lib.Entries)
+	}
+	if _, err := ScanLibrary(filepath.Join(root, "missing"), 0); err == nil {
+		t.Error("Missing library root scanned")
+	}
+}
@@ -0,0 +1,130 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Composition markers, from the MainMarkers asset of each reel, which label
+points such as the first frame of the end credits for theatre automation
+*/
+
+package dcp
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MarkerLabel names the point a marker labels
+type MarkerLabel string
+
+// Marker labels from SMPTE ST 429-7
+const (
+	MarkerFFOC MarkerLabel = "FFOC" // first frame of composition
+	MarkerLFOC MarkerLabel = "LFOC" // last frame of composition
+	MarkerFFTC MarkerLabel = "FFTC" // first frame of title credits
+	MarkerLFTC MarkerLabel = "LFTC" // last frame of title credits
+	MarkerFFOI MarkerLabel = "FFOI" // first frame of intermission
+	MarkerLFOI MarkerLabel = "LFOI" // last frame of intermission
+	MarkerFFEC MarkerLabel = "FFEC" // first frame of end credits
+	MarkerLFEC MarkerLabel = "LFEC" // last frame of end credits
+	MarkerFFMC MarkerLabel = "FFMC" // first frame of moving credits
+	MarkerLFMC MarkerLabel = "LFMC" // last frame of moving credits
+)
+
+// Markers is the markers asset of a reel; it has no essence file
+type Markers struct {
+	Asset
+	Markers []*Marker `xml:"MarkerList>Marker" json:"markers"`
+}
+
+// Marker labels the edit unit Offset edit units from the start of its reel,
+// at the markers asset's EditRate
+type Marker struct {
+	Label          MarkerLabel `json:"label"`
+	AnnotationText string      `xml:",omitempty" json:"annotationText,omitempty"`
+	Offset         uint64      `json:"offset"`
+}
+
+// CompositionMarker is a marker placed on the composition's timeline
+type CompositionMarker struct {
+	Label    MarkerLabel
+	ReelID   string
+	Position uint64        // edit units from the start of the composition, at the CPL's EditRate
+	Time     time.Duration // time from the start of the composition
+}
+
+// Markers returns the markers of every reel on the composition's timeline,
+// in order of position
+func (cpl CPL) Markers() []*CompositionMarker {
+	rate := cpl.EditRate()
+	starts := cpl.ReelStarts()
+	var markers []*CompositionMarker
+	for i, reel := range cpl.Reels {
+		if reel.Markers == nil {
+			continue
+		}
+		markerRate := reel.Markers.EditRate
+		if !markerRate.valid() {
+			markerRate = reel.EditRate()
+		}
+		for _, marker := range reel.Markers.Markers {
+			position := starts[i] + rate.Rescale(marker.Offset, markerRate)
+			markers = append(markers, &CompositionMarker{
+				Label:    marker.Label,
+				ReelID:   reel.ID,
+				Position: position,
+				Time:     rate.Duration(position)})
+		}
+	}
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].Position < markers[j].Position
+	})
+	return markers
+}
+
+// Marker returns the first marker with the given label on the composition's
+// timeline, or nil if there isn't one
+func (cpl CPL) Marker(label MarkerLabel) *CompositionMarker {
+	for _, marker := range cpl.Markers() {
+		if marker.Label == label {
+			return marker
+		}
+	}
+	return nil
+}
+
+// CodeMarkerInvalid is reported for markers outside their reel
+const CodeMarkerInvalid Code = "MARKER_INVALID"
+
+// checkMarkers checks that every marker labels an edit unit of its reel
+func checkMarkers(report *Report, cpl *CPL, file string) {
+	for _, reel := range cpl.Reels {
+		if reel.Markers == nil {
+			continue
+		}
+		markerRate := reel.Markers.EditRate
+		if !markerRate.valid() {
+			markerRate = reel.EditRate()
+		}
+		units := markerRate.Rescale(reel.Units(), reel.EditRate())
+		for _, marker := range reel.Markers.Markers {
+			if marker.Offset >= units {
+				report.Add(SeverityWarning, CodeMarkerInvalid, file, reel.Markers.ID,
+					fmt.Sprintf("Marker %s in reel %s is at offset %d, past the reel's %d edit units",
+						marker.Label, reel.ID, marker.Offset, units))
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testMarkersCPLXML is the test CPL with markers added first in its reel
+var testMarkersCPLXML = []byte(strings.Replace(string(testCPLXML), "<MainPicture>", `<MainMarkers>
+          <Id>urn:uuid:0a9f3a0c-7b7e-4c6f-9a4b-2b7f6a1f6c11</Id>
+          <EditRate>24 1</EditRate>
+          <IntrinsicDuration>23400</IntrinsicDuration>
+          <EntryPoint>0</EntryPoint>
+          <Duration>23400</Duration>
+          <MarkerList>
+            <Marker>
+              <Label>FFOC</Label>
+              <Offset>0</Offset>
+            </Marker>
+            <Marker>
+              <Label scope="http://www.smpte-ra.org/schemas/429-7/2006/CPL#standard-markers">FFEC</Label>
+              <Offset>22800</Offset>
+            </Marker>
+          </MarkerList>
+        </MainMarkers>
+        <MainPicture>`, 1))
+
+func parseMarkersCPL(t *testing.T) *CPL {
+	cpl, err := ParseCPL(testMarkersCPLXML)
+	if err != nil {
+		t.Fatalf("Error parsing CPL: %s", err)
+	}
+	return cpl
+}
+
+func TestParseMarkers(t *testing.T) {
+	cpl := parseMarkersCPL(t)
+	markers := cpl.Reels[0].Markers
+	if markers == nil || len(markers.Markers) != 2 {
+		t.Fatalf("Markers are incorrect: %+v", markers)
+	}
+	if markers.Markers[1].Label != MarkerFFEC || markers.Markers[1].Offset != 22800 {
+		t.Errorf("Marker is incorrect: %+v", markers.Markers[1])
+	}
+	// Markers aren't files, so aren't resolved against the PKL
+	if len(cpl.Reels[0].Assets()) != 2 {
+		t.Errorf("Markers should not be a reel asset")
+	}
+	xmlStr, err := MarshalCPL(cpl)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	cpl2, err := ParseCPL(xmlStr)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if cpl2.Reels[0].Markers == nil || len(cpl2.Reels[0].Markers.Markers) != 2 {
+		t.Errorf("Markers were not marshalled correctly: %s", xmlStr)
+	}
+}
+
+func TestMarshalMarkersOrder(t *testing.T) {
+	// assetLists reads the elements of each reel's AssetList
+	assetLists := func(xmlStr []byte) [][]string {
+		var doc struct {
+			Reels []struct {
+				AssetList []byte `xml:",innerxml"`
+			} `xml:"ReelList>Reel>AssetList"`
+		}
+		if err := xml.Unmarshal(xmlStr, &doc); err != nil {
+			t.Fatalf("%s", err)
+		}
+		var lists [][]string
+		for _, reel := range doc.Reels {
+			list := append(append([]byte("<AssetList>"), reel.AssetList...), "</AssetList>"...)
+			lists = append(lists, childElements(t, list))
+		}
+		return lists
+	}
+	expected := assetLists(testMarkersCPLXML)
+	xmlStr, err := MarshalCPL(parseMarkersCPL(t))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if lists := assetLists(xmlStr); !reflect.DeepEqual(lists, expected) ||
+		expected[0][0] != "MainMarkers" {
+		t.Errorf("Element order is incorrect: %v != %v", lists, expected)
+	}
+}
+
+func TestCPLMarkers(t *testing.T) {
+	cpl := parseMarkersCPL(t)
+	// Add a second reel, whose markers are at twice the edit rate
+	second := &Reel{ID: "urn:uuid:reel2",
+		Picture: &Picture{Asset: Asset{EditRate: EditRate{24, 1}, IntrinsicDuration: 240}},
+		Markers: &Markers{Asset: Asset{EditRate: EditRate{48, 1}, IntrinsicDuration: 480},
+			Markers: []*Marker{{Label: MarkerLFOC, Offset: 478}, {Label: MarkerFFMC, Offset: 240}}}}
+	cpl.Reels = append(cpl.Reels, second)
+	markers := cpl.Markers()
+	var labels []MarkerLabel
+	for _, marker := range markers {
+		labels = append(labels, marker.Label)
+	}
+	if len(labels) != 4 || labels[0] != MarkerFFOC || labels[1] != MarkerFFEC ||
+		labels[2] != MarkerFFMC || labels[3] != MarkerLFOC {
+		t.Fatalf("Markers are out of order: %v", labels)
+	}
+	ffmc := cpl.Marker(MarkerFFMC)
+	if ffmc.Position != 23520 || ffmc.Time != 980*time.Second || ffmc.ReelID != second.ID {
+		t.Errorf("FFMC is incorrect: %+v", ffmc)
+	}
+	if cpl.Marker(MarkerFFOI) != nil {
+		t.Errorf("Missing marker found")
+	}
+	// Only the markers' edit rate differing from the reel's is reported
+	if report := ValidateCPL(cpl); len(report.Findings) != 1 ||
+		report.Findings[0].Code != CodeEditRateMismatch {
+		t.Errorf("Markers should be valid: %v", report.Findings)
+	}
+	second.Markers.Markers[0].Offset = 480
+	report := ValidateCPL(cpl)
+	if len(report.Findings) != 2 || report.Findings[1].Code != CodeMarkerInvalid {
+		t.Errorf("Marker past the reel should be reported: %v", report.Findings)
+	}
+}
@@ -0,0 +1,245 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"fmt"
+	"math"
+)
+
+// Rational is a fraction used for rates and ratios
+type Rational struct {
+	Numerator   int32
+	Denominator int32
+}
+
+// Float returns the value of the fraction, or 0 if the denominator is 0
+func (r Rational) Float() float64 {
+	if r.Denominator == 0 {
+		return 0
+	}
+	return float64(r.Numerator) / float64(r.Denominator)
+}
+
+// String returns the fraction the way it's written in a CPL, e.g. "24 1"
+func (r Rational) String() string {
+	return fmt.Sprintf("%d %d", r.Numerator, r.Denominator)
+}
+
+// PictureKind is the kind of picture essence descriptor
+type PictureKind int
+
+// Picture descriptor kinds
+const (
+	UnknownPicture PictureKind = iota
+	RGBAPicture
+	CDCIPicture
+)
+
+// Keys of the essence descriptor sets
+var (
+	rgbaDescriptorKey = UL{6, 14, 43, 52, 2, 83, 1, 1, 13, 1, 1, 1, 1, 1, 41, 0}
+	cdciDescriptorKey = UL{6, 14, 43, 52, 2, 83, 1, 1, 13, 1, 1, 1, 1, 1, 40, 0}
+	waveDescriptorKey = UL{6, 14, 43, 52, 2, 83, 1, 1, 13, 1, 1, 1, 1, 1, 72, 0}
+	// Present in stereoscopic picture files, whose frames hold both eyes
+	stereoscopicSubDescriptorKey = UL{6, 14, 43, 52, 2, 83, 1, 1, 13, 1, 1, 1, 1, 1, 99, 0}
+)
+
+// Static local tags of the descriptor items used here, from ST 377-1
+const (
+	tagSampleRate        = 0x3001
+	tagContainerDuration = 0x3002
+	tagStoredHeight      = 0x3202
+	tagStoredWidth       = 0x3203
+	tagAspectRatio       = 0x320e
+	tagQuantizationBits  = 0x3d01
+	tagAudioSamplingRate = 0x3d03
+	tagChannelCount      = 0x3d07
+	tagBlockAlign        = 0x3d0a
+)
+
+// PictureDescriptor holds the RGBA or CDCI picture essence descriptor
+type PictureDescriptor struct {
+	Kind              PictureKind
+	StoredWidth       uint32
+	StoredHeight      uint32
+	AspectRatio       Rational
+	SampleRate        Rational // edit rate of the essence
+	ContainerDuration int64    // in edit units
+	Stereoscopic      bool     // set for 3D, with an image per eye in each edit unit
+}
+
+// String summarises the picture, e.g. "4K scope 24 fps (4096x1716)" or
+// "2K flat 3D 24 fps (1998x1080)"
+func (p PictureDescriptor) String() string {
+	resolution := "2K"
+	if p.StoredWidth > 2048 {
+		resolution = "4K"
+	}
+	shape := "full"
+	if p.StoredHeight > 0 {
+		ratio := float64(p.StoredWidth) / float64(p.StoredHeight)
+		switch {
+		case math.Abs(ratio-1.85) < 0.05:
+			shape = "flat"
+		case math.Abs(ratio-2.39) < 0.05:
+			shape = "scope"
+		}
+	}
+	if p.Stereoscopic {
+		shape += " 3D"
+	}
+	return fmt.Sprintf("%s %s %s fps (%dx%d)", resolution, shape,
+		formatRate(p.SampleRate.Float()), p.StoredWidth, p.StoredHeight)
+}
+
+// SoundDescriptor holds the WAVE PCM sound essence descriptor
+type SoundDescriptor struct {
+	ChannelCount      uint32
+	AudioSamplingRate Rational
+	QuantizationBits  uint32 // bit depth
+	BlockAlign        uint16
+	SampleRate        Rational // edit rate of the essence
+	ContainerDuration int64    // in edit units
+}
+
+// String summarises the sound, e.g. "5.1 48 kHz 24 bit"
+func (s SoundDescriptor) String() string {
+	var layout string
+	switch s.ChannelCount {
+	case 1:
+		layout = "mono"
+	case 2:
+		layout = "stereo"
+	case 6:
+		layout = "5.1"
+	case 8:
+		layout = "7.1"
+	default:
+		layout = fmt.Sprintf("%d ch", s.ChannelCount)
+	}
+	return fmt.Sprintf("%s %s kHz %d bit", layout,
+		formatRate(s.AudioSamplingRate.Float()/1000),
+		s.QuantizationBits)
+}
+
+// formatRate writes a rate without a fraction when it's a whole number
+func formatRate(rate float64) string {
+	return fmt.Sprintf("%.4g", rate)
+}
+
+// PictureDescriptor returns the file's picture essence descriptor, or nil
+// if it has none
+func (f *File) PictureDescriptor() (*PictureDescriptor, error) {
+	for _, packet := range f.HeaderMetadata {
+		var kind PictureKind
+		switch {
+		case packet.Key.Matches(rgbaDescriptorKey):
+			kind = RGBAPicture
+		case packet.Key.Matches(cdciDescriptorKey):
+			kind = CDCIPicture
+		default:
+			continue
+		}
+		set, err := parseLocalSet(packet.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &PictureDescriptor{
+			Kind:              kind,
+			StoredWidth:       set.uint32(tagStoredWidth),
+			StoredHeight:      set.uint32(tagStoredHeight),
+			AspectRatio:       set.rational(tagAspectRatio),
+			SampleRate:        set.rational(tagSampleRate),
+			ContainerDuration: int64(set.uint64(tagContainerDuration)),
+			Stereoscopic:      f.IsStereoscopic()}, nil
+	}
+	return nil, nil
+}
+
+// IsStereoscopic reports whether the file holds stereoscopic (3D) picture
+// essence, which has a stereoscopic picture sub-descriptor
+func (f *File) IsStereoscopic() bool {
+	for _, packet := range f.HeaderMetadata {
+		if packet.Key.Matches(stereoscopicSubDescriptorKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// SoundDescriptor returns the file's sound essence descriptor, or nil if it
+// has none
+func (f *File) SoundDescriptor() (*SoundDescriptor, error) {
+	for _, packet := range f.HeaderMetadata {
+		if !packet.Key.Matches(waveDescriptorKey) {
+			continue
+		}
+		set, err := parseLocalSet(packet.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &SoundDescriptor{
+			ChannelCount:      set.uint32(tagChannelCount),
+			AudioSamplingRate: set.rational(tagAudioSamplingRate),
+			QuantizationBits:  set.uint32(tagQuantizationBits),
+			BlockAlign:        set.uint16(tagBlockAlign),
+			SampleRate:        set.rational(tagSampleRate),
+			ContainerDuration: int64(set.uint64(tagContainerDuration))}, nil
+	}
+	return nil, nil
+}
+
+// localSet is a header metadata set decoded into its items, keyed by tag
+type localSet map[uint16][]byte
+
+// parseLocalSet splits a local set value into its 2 byte tag, 2 byte
+// length items
+func parseLocalSet(value []byte) (localSet, error) {
+	set := localSet{}
+	d := &decoder{data: value}
+	for len(d.data) > 0 && d.err == nil {
+		tag := d.uint16()
+		length := d.uint16()
+		if item := d.take(int(length)); item != nil {
+			set[tag] = item
+		}
+	}
+	return set, d.err
+}
+
+// decoder returns a decoder over the item with the given tag; missing
+// items decode as zero values
+func (s localSet) decoder(tag uint16) *decoder {
+	return &decoder{data: s[tag]}
+}
+
+func (s localSet) uint16(tag uint16) uint16 {
+	return s.decoder(tag).uint16()
+}
+
+func (s localSet) uint32(tag uint16) uint32 {
+	return s.decoder(tag).uint32()
+}
+
+func (s localSet) uint64(tag uint16) uint64 {
+	return s.decoder(tag).uint64()
+}
+
+func (s localSet) rational(tag uint16) Rational {
+	d := s.decoder(tag)
+	return Rational{int32(d.uint32()), int32(d.uint32())}
+}
@@ -0,0 +1,121 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"bytes"
+	"testing"
+)
+
+// encodeLocalSet builds a local set from tag and value pairs
+func encodeLocalSet(key UL, items map[uint16][]byte) []byte {
+	var value []byte
+	for tag, item := range items {
+		value = append(value, encodeFields(tag, uint16(len(item)))...)
+		value = append(value, item...)
+	}
+	return encodeKLV(key, value)
+}
+
+func TestPictureDescriptor(t *testing.T) {
+	set := encodeLocalSet(rgbaDescriptorKey, map[uint16][]byte{
+		tagSampleRate:        encodeFields(int32(24), int32(1)),
+		tagContainerDuration: encodeFields(int64(23400)),
+		tagStoredWidth:       encodeFields(uint32(4096)),
+		tagStoredHeight:      encodeFields(uint32(1716)),
+		tagAspectRatio:       encodeFields(int32(4096), int32(1716)),
+	})
+	f, err := Parse(bytes.NewReader(buildMXF(0, [][]byte{set}, true)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	p, err := f.PictureDescriptor()
+	if err != nil || p == nil {
+		t.Fatalf("Picture descriptor not found: %v", err)
+	}
+	if p.Kind != RGBAPicture || p.StoredWidth != 4096 || p.StoredHeight != 1716 {
+		t.Errorf("Picture descriptor is incorrect: %+v", p)
+	}
+	if p.SampleRate != (Rational{24, 1}) || p.ContainerDuration != 23400 {
+		t.Errorf("Picture rate or duration is incorrect: %s, %d", p.SampleRate, p.ContainerDuration)
+	}
+	expected := "4K scope 24 fps (4096x1716)"
+	if p.String() != expected {
+		t.Errorf("Picture summary is incorrect: %s != %s", p.String(), expected)
+	}
+	if s, err := f.SoundDescriptor(); s != nil || err != nil {
+		t.Errorf("Picture file should have no sound descriptor")
+	}
+}
+
+func TestStereoscopicPictureDescriptor(t *testing.T) {
+	set := encodeLocalSet(cdciDescriptorKey, map[uint16][]byte{
+		tagSampleRate:   encodeFields(int32(24), int32(1)),
+		tagStoredWidth:  encodeFields(uint32(1998)),
+		tagStoredHeight: encodeFields(uint32(1080)),
+	})
+	f, err := Parse(bytes.NewReader(buildMXF(0, [][]byte{set}, true)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if f.IsStereoscopic() {
+		t.Errorf("2D picture file should not be stereoscopic")
+	}
+	sub := encodeLocalSet(stereoscopicSubDescriptorKey, map[uint16][]byte{})
+	f, err = Parse(bytes.NewReader(buildMXF(0, [][]byte{set, sub}, true)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	p, err := f.PictureDescriptor()
+	if err != nil || p == nil {
+		t.Fatalf("Picture descriptor not found: %v", err)
+	}
+	expected := "2K flat 3D 24 fps (1998x1080)"
+	if !f.IsStereoscopic() || !p.Stereoscopic || p.String() != expected {
+		t.Errorf("Picture should be stereoscopic: %s", p)
+	}
+}
+
+func TestSoundDescriptor(t *testing.T) {
+	set := encodeLocalSet(waveDescriptorKey, map[uint16][]byte{
+		tagSampleRate:        encodeFields(int32(24), int32(1)),
+		tagAudioSamplingRate: encodeFields(int32(48000), int32(1)),
+		tagChannelCount:      encodeFields(uint32(6)),
+		tagQuantizationBits:  encodeFields(uint32(24)),
+		tagBlockAlign:        encodeFields(uint16(18)),
+	})
+	f, err := Parse(bytes.NewReader(buildMXF(0, [][]byte{set}, true)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	s, err := f.SoundDescriptor()
+	if err != nil || s == nil {
+		t.Fatalf("Sound descriptor not found: %v", err)
+	}
+	if s.ChannelCount != 6 || s.QuantizationBits != 24 || s.BlockAlign != 18 {
+		t.Errorf("Sound descriptor is incorrect: %+v", s)
+	}
+	expected := "5.1 48 kHz 24 bit"
+	if s.String() != expected {
+		t.Errorf("Sound summary is incorrect: %s != %s", s.String(), expected)
+	}
+}
+
+func TestParseLocalSetTruncated(t *testing.T) {
+	if _, err := parseLocalSet([]byte{0x32, 0x03, 0x00, 0x04, 0x00}); err == nil {
+		t.Errorf("A truncated local set should fail to parse")
+	}
+}
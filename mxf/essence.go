@@ -0,0 +1,40 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"io"
+)
+
+// TimedTextEssence is the key of the essence element holding the XML
+// document of a SMPTE subtitle track file (SMPTE ST 429-5)
+var TimedTextEssence = UL{6, 14, 43, 52, 1, 2, 1, 1, 13, 1, 3, 1, 23, 1, 11, 1}
+
+// ReadTimedText returns the XML document from a timed text track file
+func ReadTimedText(r io.ReadSeeker) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	kr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	klv, err := kr.Find(TimedTextEssence)
+	if err != nil {
+		return nil, err
+	}
+	return kr.ReadValue(klv)
+}
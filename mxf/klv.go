@@ -0,0 +1,262 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Package mxf reads the KLV structure of MXF files (SMPTE ST 377-1), which
+hold the picture and sound essence of a DCP.
+*/
+package mxf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// UL is a SMPTE Universal Label, used as the key of a KLV triplet
+type UL [16]byte
+
+// String returns the UL as dotted hex, the way they're written in registers
+func (ul UL) String() string {
+	s := ""
+	for i, b := range ul {
+		if i > 0 && i%4 == 0 {
+			s += "."
+		}
+		s += fmt.Sprintf("%02x", b)
+	}
+	return s
+}
+
+// Matches compares two ULs, ignoring the registry version byte
+func (ul UL) Matches(other UL) bool {
+	for i := range ul {
+		if i != 7 && ul[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPrefix checks if the UL starts with prefix, ignoring the registry
+// version byte
+func (ul UL) hasPrefix(prefix []byte) bool {
+	for i, b := range prefix {
+		if i != 7 && ul[i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// KLV is a key-length-value triplet found in an MXF file
+type KLV struct {
+	Key         UL
+	Length      uint64 // length of the value
+	Offset      int64  // file offset of the key
+	ValueOffset int64  // file offset of the value
+}
+
+// End returns the file offset of the byte after the triplet
+func (klv KLV) End() int64 {
+	return klv.ValueOffset + int64(klv.Length)
+}
+
+// fillKey identifies KLV fill items, which pad to the KAG
+var fillKey = UL{6, 14, 43, 52, 1, 1, 1, 2, 3, 1, 2, 16, 1, 0, 0, 0}
+
+// IsFill checks if the triplet is a KLV fill item
+func (klv KLV) IsFill() bool {
+	return klv.Key.Matches(fillKey)
+}
+
+// Reader walks the KLV triplets of an MXF file
+type Reader struct {
+	r    io.ReadSeeker
+	next int64 // offset of the next triplet's key
+	size int64 // size of the stream, which bounds the values read
+}
+
+// NewReader creates a Reader starting at the current offset of r
+func NewReader(r io.ReadSeeker) (*Reader, error) {
+	offset, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, next: offset, size: size}, nil
+}
+
+// Next reads the key and length of the next triplet, skipping the value of
+// the previous one; it returns io.EOF when there are no more triplets
+func (r *Reader) Next() (*KLV, error) {
+	if _, err := r.r.Seek(r.next, io.SeekStart); err != nil {
+		return nil, err
+	}
+	klv := &KLV{Offset: r.next}
+	if _, err := io.ReadFull(r.r, klv.Key[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("Truncated KLV key")
+		}
+		return nil, err
+	}
+	length, n, err := readBERLength(r.r)
+	if err != nil {
+		return nil, err
+	}
+	klv.Length = length
+	klv.ValueOffset = klv.Offset + 16 + int64(n)
+	r.next = klv.End()
+	return klv, nil
+}
+
+// SeekTo moves the reader so the next triplet is read from offset
+func (r *Reader) SeekTo(offset int64) {
+	r.next = offset
+}
+
+// Find reads triplets until one whose key matches key, returning io.EOF if
+// there isn't one
+func (r *Reader) Find(key UL) (*KLV, error) {
+	for {
+		klv, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if klv.Key.Matches(key) {
+			return klv, nil
+		}
+	}
+}
+
+// ReadValue reads the value of a triplet; the length comes from the file,
+// so it's checked against the size of the stream before allocating
+func (r *Reader) ReadValue(klv *KLV) ([]byte, error) {
+	if klv.ValueOffset > r.size || klv.Length > uint64(r.size-klv.ValueOffset) {
+		return nil, fmt.Errorf("KLV value at offset %d is longer than the file: %d bytes",
+			klv.ValueOffset, klv.Length)
+	}
+	if _, err := r.r.Seek(klv.ValueOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	value := make([]byte, klv.Length)
+	if _, err := io.ReadFull(r.r, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// readBERLength reads a BER encoded length, returning the length and the
+// number of bytes used to encode it
+func readBERLength(r io.Reader) (uint64, int, error) {
+	var b [9]byte
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return 0, 0, err
+	}
+	if b[0] < 0x80 {
+		return uint64(b[0]), 1, nil
+	}
+	n := int(b[0] & 0x7f)
+	if n == 0 || n > 8 {
+		return 0, 0, fmt.Errorf("Invalid BER length size: %d", n)
+	}
+	if _, err := io.ReadFull(r, b[1:1+n]); err != nil {
+		return 0, 0, err
+	}
+	var length uint64
+	for _, v := range b[1 : 1+n] {
+		length = length<<8 | uint64(v)
+	}
+	return length, 1 + n, nil
+}
+
+// decoder reads big-endian fields from a KLV value
+type decoder struct {
+	data []byte
+	err  error
+}
+
+// take returns the next n bytes, or nil once the value is exhausted
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.err = errors.New("Truncated KLV value")
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint8() uint8 {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) ul() UL {
+	var ul UL
+	if b := d.take(16); b != nil {
+		copy(ul[:], b)
+	}
+	return ul
+}
+
+// batch reads a batch header, returning the item count; the item length
+// must match itemLen
+func (d *decoder) batch(itemLen uint32) uint32 {
+	count := d.uint32()
+	if length := d.uint32(); d.err == nil && length != itemLen {
+		d.err = fmt.Errorf("Batch item length is incorrect: %d != %d", length, itemLen)
+	}
+	if d.err != nil || uint64(len(d.data)) < uint64(count)*uint64(itemLen) {
+		if d.err == nil {
+			d.err = errors.New("Truncated batch")
+		}
+		return 0
+	}
+	return count
+}
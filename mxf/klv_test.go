@@ -0,0 +1,121 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+var berLengthTests = []struct {
+	in     []byte
+	length uint64
+	n      int
+}{
+	{[]byte{0x10}, 16, 1},
+	{[]byte{0x81, 0xff}, 255, 2},
+	{[]byte{0x83, 0x01, 0x00, 0x00}, 65536, 4},
+	{[]byte{0x88, 0, 0, 0, 1, 0, 0, 0, 0}, 1 << 32, 9},
+}
+
+func TestReadBERLength(t *testing.T) {
+	for _, tt := range berLengthTests {
+		length, n, err := readBERLength(bytes.NewReader(tt.in))
+		if err != nil || length != tt.length || n != tt.n {
+			t.Errorf("readBERLength(%v) => %d, %d, %v, want %d, %d",
+				tt.in, length, n, err, tt.length, tt.n)
+		}
+	}
+	if _, _, err := readBERLength(bytes.NewReader([]byte{0x89})); err == nil {
+		t.Errorf("A 9 byte BER length should be rejected")
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := append(encodeKLV(testSetKey, []byte("abc")), encodeKLV(fillKey, nil)...)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	klv, err := r.Next()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if klv.Key != testSetKey || klv.Length != 3 || klv.ValueOffset != 20 {
+		t.Errorf("First triplet is incorrect: %v", klv)
+	}
+	if value, err := r.ReadValue(klv); err != nil || string(value) != "abc" {
+		t.Errorf("First value is incorrect: %q, %v", value, err)
+	}
+	if klv, err = r.Next(); err != nil || !klv.IsFill() || klv.Offset != 23 {
+		t.Errorf("Second triplet is incorrect: %v, %v", klv, err)
+	}
+	if _, err = r.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last triplet: %v", err)
+	}
+}
+
+func TestReadValueOversized(t *testing.T) {
+	// A length of 2^62 bytes, with a three byte value
+	data := append(append(append([]byte{}, testSetKey[:]...),
+		0x88, 0x40, 0, 0, 0, 0, 0, 0, 0), "abc"...)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	klv, err := r.Next()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if klv.Length != 1<<62 {
+		t.Errorf("Length is incorrect: %d", klv.Length)
+	}
+	if _, err := r.ReadValue(klv); err == nil {
+		t.Errorf("A value longer than the file should be rejected")
+	}
+	// One byte too long
+	data = append(encodeKLV(testSetKey, []byte("abc")), encodeKLV(fillKey, nil)...)
+	r, err = NewReader(bytes.NewReader(data[:22]))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if klv, err = r.Next(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := r.ReadValue(klv); err == nil {
+		t.Errorf("A truncated value should be rejected")
+	}
+}
+
+func TestULString(t *testing.T) {
+	expected := "060e2b34.04010102.0d010201.10000000"
+	if opAtom.String() != expected {
+		t.Errorf("UL string is incorrect: %s != %s", opAtom.String(), expected)
+	}
+}
+
+func TestReadTimedText(t *testing.T) {
+	data := buildMXF(0, nil, true)
+	data = append(data, encodeKLV(TimedTextEssence, []byte("<SubtitleReel/>"))...)
+	value, err := ReadTimedText(bytes.NewReader(data))
+	if err != nil || string(value) != "<SubtitleReel/>" {
+		t.Errorf("Timed text is incorrect: %q, %v", value, err)
+	}
+	if _, err := ReadTimedText(bytes.NewReader(buildMXF(0, nil, true))); err != io.EOF {
+		t.Errorf("File without timed text should return io.EOF: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxRunIn is the largest run-in allowed before the header partition
+const maxRunIn = 65536
+
+// headerProbe is how much of a file ParseHeader reads to find the header
+// partition pack, which is never near this size
+const headerProbe = 2 * maxRunIn
+
+// maxHeaderMetadata bounds the header metadata ParseHeader reads
+const maxHeaderMetadata = 64 << 20
+
+// Packet is a KLV triplet together with its value
+type Packet struct {
+	KLV
+	Value []byte
+}
+
+// File is the KLV structure of an MXF file
+type File struct {
+	RunIn          int64        // bytes before the header partition
+	Partitions     []*Partition // in file order, header partition first
+	Primer         Primer
+	HeaderMetadata []*Packet // header metadata sets, without the primer pack and fill
+	RIP            *RIP      // nil if the file has no random index pack
+}
+
+// HeaderPartition returns the file's header partition
+func (f *File) HeaderPartition() *Partition {
+	return f.Partitions[0]
+}
+
+// FooterPartition returns the file's footer partition, or nil if it has none
+func (f *File) FooterPartition() *Partition {
+	last := f.Partitions[len(f.Partitions)-1]
+	if last.Kind != FooterPartition {
+		return nil
+	}
+	return last
+}
+
+// ParseFile parses the MXF file whose file path is filename
+func ParseFile(filename string) (*File, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// Parse reads the partitions, primer pack, header metadata and random index
+// pack of an MXF file
+func Parse(r io.ReadSeeker) (*File, error) {
+	f, kr, header, err := parseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if f.RIP, err = ReadRIP(r); err != nil {
+		return nil, err
+	}
+	if f.Partitions, err = f.readPartitions(kr, header); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+/*
+ParseHeader reads the header partition, primer pack and header metadata of
+an MXF file from r, which needn't seek. Only the start of the file is read,
+so the File has no other partitions and no random index pack
+*/
+func ParseHeader(r io.Reader) (*File, error) {
+	data, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	f, _, header, err := parseHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	f.Partitions = []*Partition{header}
+	return f, nil
+}
+
+// parseHeader reads the header partition pack, primer pack and header
+// metadata; it returns the reader positioned after them
+func parseHeader(r io.ReadSeeker) (*File, *Reader, *Partition, error) {
+	runIn, err := findHeaderPartition(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	f := &File{RunIn: runIn}
+	if _, err := r.Seek(runIn, io.SeekStart); err != nil {
+		return nil, nil, nil, err
+	}
+	kr, err := NewReader(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	header, klv, err := readPartition(kr, runIn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if header.Kind != HeaderPartition {
+		return nil, nil, nil, errors.New("The first partition is not a header partition")
+	}
+	if err := f.readHeaderMetadata(kr, klv.End(), header.HeaderByteCount); err != nil {
+		return nil, nil, nil, err
+	}
+	return f, kr, header, nil
+}
+
+// readHeader reads the start of an MXF file up to the end of its header
+// metadata, without reading any further than headerProbe beyond it
+func readHeader(r io.Reader) ([]byte, error) {
+	data, err := readUpTo(r, nil, headerProbe)
+	if err != nil {
+		return nil, err
+	}
+	br := bytes.NewReader(data)
+	runIn, err := findHeaderPartition(br)
+	if err != nil {
+		return nil, err
+	}
+	kr, err := NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	header, klv, err := readPartition(kr, runIn)
+	if err != nil {
+		return nil, err
+	}
+	if header.HeaderByteCount > maxHeaderMetadata {
+		return nil, fmt.Errorf("Header metadata is too large: %d bytes", header.HeaderByteCount)
+	}
+	if end := klv.End() + int64(header.HeaderByteCount); end > int64(len(data)) {
+		return readUpTo(r, data, end)
+	}
+	return data, nil
+}
+
+// readUpTo reads from r until data holds n bytes or r ends
+func readUpTo(r io.Reader, data []byte, n int64) ([]byte, error) {
+	buf := make([]byte, n-int64(len(data)))
+	m, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return append(data, buf[:m]...), err
+}
+
+// findHeaderPartition returns the offset of the header partition pack,
+// which may follow a run-in
+func findHeaderPartition(r io.ReadSeeker) (int64, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	data := make([]byte, maxRunIn+len(partitionPackPrefix)+1)
+	n, err := io.ReadFull(r, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	prefix := append(append([]byte{}, partitionPackPrefix...), byte(HeaderPartition+1))
+	for i := 0; i+len(prefix) <= n; i++ {
+		var ul UL
+		copy(ul[:], data[i:n])
+		if ul.hasPrefix(prefix) {
+			return int64(i), nil
+		}
+	}
+	return 0, errors.New("Unable to find an MXF header partition")
+}
+
+// readPartition reads the partition pack at offset
+func readPartition(kr *Reader, offset int64) (*Partition, *KLV, error) {
+	kr.SeekTo(offset)
+	klv, err := kr.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := kr.ReadValue(klv)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := ParsePartitionPack(klv.Key, value)
+	return p, klv, err
+}
+
+// readHeaderMetadata reads the primer pack and header metadata sets, which
+// take up count bytes from offset
+func (f *File) readHeaderMetadata(kr *Reader, offset int64, count uint64) error {
+	end := offset + int64(count)
+	kr.SeekTo(offset)
+	for offset < end {
+		klv, err := kr.Next()
+		if err != nil {
+			return err
+		}
+		offset = klv.End()
+		if klv.IsFill() {
+			continue
+		}
+		value, err := kr.ReadValue(klv)
+		if err != nil {
+			return err
+		}
+		if IsPrimerPack(klv.Key) {
+			if f.Primer, err = ParsePrimerPack(value); err != nil {
+				return err
+			}
+			continue
+		}
+		f.HeaderMetadata = append(f.HeaderMetadata, &Packet{*klv, value})
+	}
+	if f.Primer == nil && count > 0 {
+		return errors.New("Header metadata has no primer pack")
+	}
+	return nil
+}
+
+// readPartitions reads every partition pack in the file, using the random
+// index pack if there is one and otherwise walking back from the footer
+func (f *File) readPartitions(kr *Reader, header *Partition) ([]*Partition, error) {
+	partitions := []*Partition{header}
+	if f.RIP != nil {
+		for _, entry := range f.RIP.Entries {
+			if entry.ByteOffset == header.ThisPartition {
+				continue
+			}
+			p, _, err := readPartition(kr, f.RunIn+int64(entry.ByteOffset))
+			if err != nil {
+				return nil, err
+			}
+			partitions = append(partitions, p)
+		}
+		return partitions, nil
+	}
+	var reversed []*Partition
+	for offset := header.FooterPartition; offset > header.ThisPartition; {
+		p, _, err := readPartition(kr, f.RunIn+int64(offset))
+		if err != nil {
+			return nil, err
+		}
+		if p.PreviousPartition >= offset {
+			return nil, errors.New("Partitions do not form a chain")
+		}
+		reversed = append(reversed, p)
+		offset = p.PreviousPartition
+	}
+	for i := len(reversed) - 1; i >= 0; i-- {
+		partitions = append(partitions, reversed[i])
+	}
+	return partitions, nil
+}
@@ -0,0 +1,180 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+var opAtom = UL{6, 14, 43, 52, 4, 1, 1, 2, 13, 1, 2, 1, 16, 0, 0, 0}
+var jp2kContainer = UL{6, 14, 43, 52, 4, 1, 1, 7, 13, 1, 3, 1, 2, 12, 1, 0}
+var testSetKey = UL{6, 14, 43, 52, 2, 83, 1, 1, 13, 1, 1, 1, 1, 1, 47, 0}
+
+// encodeKLV builds a KLV triplet, using a 4 byte BER length like most
+// MXF writers
+func encodeKLV(key UL, value []byte) []byte {
+	b := append([]byte{}, key[:]...)
+	b = append(b, 0x83, byte(len(value)>>16), byte(len(value)>>8), byte(len(value)))
+	return append(b, value...)
+}
+
+// encodeFields writes big-endian fields one after the other
+func encodeFields(fields ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, f := range fields {
+		binary.Write(&b, binary.BigEndian, f)
+	}
+	return b.Bytes()
+}
+
+// encodePartition builds a closed and complete partition pack of the given
+// kind (2 header, 3 body, 4 footer)
+func encodePartition(kind byte, this, prev, footer, headerByteCount uint64) []byte {
+	var key UL
+	copy(key[:], partitionPackPrefix)
+	key[13], key[14] = kind, 4
+	return encodeKLV(key, encodeFields(uint16(1), uint16(3), uint32(1),
+		this, prev, footer, headerByteCount, uint64(0), uint32(0), uint64(0), uint32(1),
+		opAtom, uint32(1), uint32(16), jp2kContainer))
+}
+
+// encodePrimer builds a primer pack from tag and UL pairs
+func encodePrimer(tags map[uint16]UL) []byte {
+	value := encodeFields(uint32(len(tags)), uint32(18))
+	for tag, ul := range tags {
+		value = append(value, encodeFields(tag, ul)...)
+	}
+	return encodeKLV(primerPackKey, value)
+}
+
+// buildMXF lays out an MXF file with a run-in, a header partition holding
+// the primer, fill and the given sets, a body partition, a footer
+// partition and optionally a random index pack
+func buildMXF(runIn int, sets [][]byte, withRIP bool) []byte {
+	metadata := encodePrimer(map[uint16]UL{0x3c0a: {6, 14, 43, 52, 1, 1, 1, 1, 1, 1, 21, 2}})
+	metadata = append(metadata, encodeKLV(fillKey, make([]byte, 10))...)
+	for _, set := range sets {
+		metadata = append(metadata, set...)
+	}
+	headerLen := len(encodePartition(2, 0, 0, 0, 0))
+	bodyOffset := uint64(headerLen + len(metadata))
+	body := append(encodePartition(3, bodyOffset, 0, 0, 0), encodeKLV(fillKey, make([]byte, 30))...)
+	footerOffset := bodyOffset + uint64(len(body))
+	data := make([]byte, runIn)
+	data = append(data, encodePartition(2, 0, 0, footerOffset, uint64(len(metadata)))...)
+	data = append(data, metadata...)
+	data = append(data, body...)
+	data = append(data, encodePartition(4, footerOffset, bodyOffset, footerOffset, 0)...)
+	if withRIP {
+		value := encodeFields(uint32(0), uint64(0), uint32(1), bodyOffset,
+			uint32(0), footerOffset, uint32(16+4+36+4))
+		data = append(data, encodeKLV(ripKey, value)...)
+	}
+	return data
+}
+
+func TestParse(t *testing.T) {
+	set := encodeKLV(testSetKey, []byte{1, 2, 3})
+	for _, withRIP := range []bool{true, false} {
+		f, err := Parse(bytes.NewReader(buildMXF(8, [][]byte{set}, withRIP)))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if f.RunIn != 8 {
+			t.Errorf("Run-in is incorrect: %d != %d", f.RunIn, 8)
+		}
+		if (f.RIP != nil) != withRIP {
+			t.Errorf("RIP presence is incorrect: %v != %v", f.RIP != nil, withRIP)
+		}
+		if len(f.Partitions) != 3 {
+			t.Fatalf("Partition count is incorrect: %d != %d", len(f.Partitions), 3)
+		}
+		for i, kind := range []PartitionKind{HeaderPartition, BodyPartition, FooterPartition} {
+			if f.Partitions[i].Kind != kind {
+				t.Errorf("Partition %d kind is incorrect: %s != %s", i, f.Partitions[i].Kind, kind)
+			}
+		}
+		if f.FooterPartition() == nil || !f.HeaderPartition().Closed || !f.HeaderPartition().Complete {
+			t.Errorf("Header partition status or footer partition is incorrect")
+		}
+		if !f.HeaderPartition().OperationalPattern.Matches(opAtom) {
+			t.Errorf("Operational pattern is incorrect: %s", f.HeaderPartition().OperationalPattern)
+		}
+		containers := f.HeaderPartition().EssenceContainers
+		if len(containers) != 1 || containers[0] != jp2kContainer {
+			t.Errorf("Essence containers are incorrect: %v", containers)
+		}
+		if len(f.Primer) != 1 {
+			t.Errorf("Primer size is incorrect: %d != %d", len(f.Primer), 1)
+		}
+		if len(f.HeaderMetadata) != 1 || !bytes.Equal(f.HeaderMetadata[0].Value, []byte{1, 2, 3}) {
+			t.Errorf("Header metadata is incorrect: %v", f.HeaderMetadata)
+		}
+	}
+}
+
+// countingReader reads forward only, counting the bytes read
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestParseHeader(t *testing.T) {
+	set := encodeKLV(testSetKey, []byte{1, 2, 3})
+	essence := 4 * headerProbe
+	data := append(buildMXF(8, [][]byte{set}, true), make([]byte, essence)...)
+	r := &countingReader{r: bytes.NewReader(data)}
+	f, err := ParseHeader(r)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if f.RunIn != 8 || len(f.Partitions) != 1 || f.RIP != nil || f.FooterPartition() != nil {
+		t.Errorf("Only the header partition should be read: %d %v %v",
+			f.RunIn, f.Partitions, f.RIP)
+	}
+	if len(f.HeaderMetadata) != 1 || !bytes.Equal(f.HeaderMetadata[0].Value, []byte{1, 2, 3}) {
+		t.Errorf("Header metadata is incorrect: %v", f.HeaderMetadata)
+	}
+	if r.read > headerProbe {
+		t.Errorf("Too much was read: %d > %d", r.read, headerProbe)
+	}
+	// The header metadata can run past the probe
+	data = buildMXF(0, [][]byte{encodeKLV(testSetKey, make([]byte, 2*headerProbe))}, false)
+	if f, err = ParseHeader(bytes.NewReader(data)); err != nil || len(f.HeaderMetadata) != 1 {
+		t.Errorf("Large header metadata should be read: %v", err)
+	}
+	// A corrupt header byte count isn't allocated
+	data = buildMXF(0, [][]byte{set}, false)
+	copy(data[16+4+32:], encodeFields(uint64(1<<62)))
+	if _, err := ParseHeader(bytes.NewReader(data)); err == nil {
+		t.Errorf("Huge header byte count should be rejected")
+	}
+}
+
+func TestParseNotMXF(t *testing.T) {
+	if _, err := Parse(bytes.NewReader([]byte("<?xml version=\"1.0\"?>"))); err == nil {
+		t.Errorf("Parsing a non MXF file should fail")
+	}
+}
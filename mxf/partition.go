@@ -0,0 +1,105 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"fmt"
+)
+
+// PartitionKind is the kind of partition: header, body or footer
+type PartitionKind int
+
+// Partition kinds
+const (
+	UnknownPartition PartitionKind = iota
+	HeaderPartition
+	BodyPartition
+	FooterPartition
+)
+
+// String returns the name of the partition kind
+func (k PartitionKind) String() string {
+	switch k {
+	case HeaderPartition:
+		return "header"
+	case BodyPartition:
+		return "body"
+	case FooterPartition:
+		return "footer"
+	}
+	return "unknown"
+}
+
+// partitionPackPrefix is shared by the keys of all partition packs; the
+// next two bytes give the kind and status
+var partitionPackPrefix = []byte{6, 14, 43, 52, 2, 5, 1, 1, 13, 1, 2, 1, 1}
+
+// Partition is a decoded partition pack
+type Partition struct {
+	Kind               PartitionKind
+	Closed             bool
+	Complete           bool
+	MajorVersion       uint16
+	MinorVersion       uint16
+	KAGSize            uint32
+	ThisPartition      uint64
+	PreviousPartition  uint64
+	FooterPartition    uint64
+	HeaderByteCount    uint64
+	IndexByteCount     uint64
+	IndexSID           uint32
+	BodyOffset         uint64
+	BodySID            uint32
+	OperationalPattern UL
+	EssenceContainers  []UL
+}
+
+// IsPartitionPack checks if a key is that of a partition pack
+func IsPartitionPack(key UL) bool {
+	return key.hasPrefix(partitionPackPrefix) && key[13] >= 2 && key[13] <= 4
+}
+
+// ParsePartitionPack decodes a partition pack from its key and value
+func ParsePartitionPack(key UL, value []byte) (*Partition, error) {
+	if !IsPartitionPack(key) {
+		return nil, fmt.Errorf("Not a partition pack key: %s", key)
+	}
+	p := &Partition{Kind: PartitionKind(key[13] - 1)}
+	// Status: 1 open incomplete, 2 closed incomplete, 3 open complete,
+	// 4 closed complete
+	p.Closed = key[14] == 2 || key[14] == 4
+	p.Complete = key[14] == 3 || key[14] == 4
+	d := &decoder{data: value}
+	p.MajorVersion = d.uint16()
+	p.MinorVersion = d.uint16()
+	p.KAGSize = d.uint32()
+	p.ThisPartition = d.uint64()
+	p.PreviousPartition = d.uint64()
+	p.FooterPartition = d.uint64()
+	p.HeaderByteCount = d.uint64()
+	p.IndexByteCount = d.uint64()
+	p.IndexSID = d.uint32()
+	p.BodyOffset = d.uint64()
+	p.BodySID = d.uint32()
+	p.OperationalPattern = d.ul()
+	for i := d.batch(16); i > 0; i-- {
+		p.EssenceContainers = append(p.EssenceContainers, d.ul())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return p, nil
+}
@@ -0,0 +1,49 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"errors"
+)
+
+// primerPackKey identifies the primer pack, which maps the local tags used
+// in header metadata sets to ULs
+var primerPackKey = UL{6, 14, 43, 52, 2, 5, 1, 1, 13, 1, 2, 1, 1, 5, 1, 0}
+
+// Primer maps local tags to the ULs of the items they stand for
+type Primer map[uint16]UL
+
+// IsPrimerPack checks if a key is that of a primer pack
+func IsPrimerPack(key UL) bool {
+	return key.Matches(primerPackKey)
+}
+
+// ParsePrimerPack decodes a primer pack value
+func ParsePrimerPack(value []byte) (Primer, error) {
+	primer := Primer{}
+	d := &decoder{data: value}
+	for i := d.batch(18); i > 0; i-- {
+		tag := d.uint16()
+		primer[tag] = d.ul()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.data) != 0 {
+		return nil, errors.New("Unexpected data after the primer pack batch")
+	}
+	return primer, nil
+}
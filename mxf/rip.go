@@ -0,0 +1,94 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mxf
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ripKey identifies the random index pack at the end of an MXF file
+var ripKey = UL{6, 14, 43, 52, 2, 5, 1, 1, 13, 1, 2, 1, 1, 17, 1, 0}
+
+// RIPEntry locates a partition in the file
+type RIPEntry struct {
+	BodySID    uint32
+	ByteOffset uint64
+}
+
+// RIP is a random index pack, listing every partition in the file
+type RIP struct {
+	Entries []RIPEntry
+}
+
+// IsRIP checks if a key is that of a random index pack
+func IsRIP(key UL) bool {
+	return key.Matches(ripKey)
+}
+
+// ParseRIP decodes a random index pack value
+func ParseRIP(value []byte) (*RIP, error) {
+	// The value ends with the overall length of the pack
+	if len(value) < 4 || (len(value)-4)%12 != 0 {
+		return nil, errors.New("Random index pack has an invalid length")
+	}
+	rip := &RIP{}
+	d := &decoder{data: value[:len(value)-4]}
+	for len(d.data) > 0 {
+		rip.Entries = append(rip.Entries, RIPEntry{d.uint32(), d.uint64()})
+	}
+	return rip, d.err
+}
+
+// ReadRIP reads the random index pack from the end of an MXF file; it
+// returns nil without an error if the file has no random index pack
+func ReadRIP(r io.ReadSeeker) (*RIP, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size < 4 {
+		return nil, nil
+	}
+	var b [4]byte
+	if _, err := r.Seek(-4, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	length := int64(binary.BigEndian.Uint32(b[:]))
+	if length < 20 || length > size {
+		return nil, nil
+	}
+	if _, err := r.Seek(size-length, io.SeekStart); err != nil {
+		return nil, err
+	}
+	kr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	klv, err := kr.Next()
+	if err != nil || !IsRIP(klv.Key) || klv.End() != size {
+		return nil, nil
+	}
+	value, err := kr.ReadValue(klv)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRIP(value)
+}
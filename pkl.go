@@ -22,29 +22,49 @@ package dcp
 
 import (
 	"encoding/xml"
+	"errors"
+	"io"
 	"io/ioutil"
 	"time"
 )
 
+// PKL namespaces
+const (
+	interopPKLNamespace = "http://www.digicine.com/PROTO-ASDCP-PKL-20040311#"
+	smptePKLNamespace   = "http://www.smpte-ra.org/schemas/429-8/2007/PKL"
+)
+
 // PKL is returned from the parser
 type PKL struct {
-	ID             string `xml:"Id"`
-	AnnotationText string
-	IssueDate      time.Time
-	Issuer         string
-	Creator        string
-	Assets         []*PKLAsset `xml:"AssetList>Asset"`
+	Format         Format      `xml:"-" json:"format"`
+	ID             string      `xml:"Id" json:"id"`
+	AnnotationText string      `xml:",omitempty" json:"annotationText"`
+	IssueDate      time.Time   `json:"issueDate"`
+	Issuer         string      `json:"issuer"`
+	Creator        string      `json:"creator"`
+	Assets         []*PKLAsset `xml:"AssetList>Asset" json:"assets"`
+	Signer         *Signer     `xml:"-" json:"signer,omitempty"` // nil if the PKL is unsigned
+
+	raw []byte // XML document the PKL was parsed from
 }
 
 // PKLAsset is an asset found inside a PKL
 type PKLAsset struct {
-	ID             string `xml:"Id"`
-	AnnotationText string
-	Hash           string
-	Size           uint64
-	MimeType       string `xml:"Type"`
-	// PreventMatch tag prevents clash with the Type tag
-	Type AssetType `xml:"PreventMatch"`
+	ID             string `xml:"Id" json:"id"`
+	AnnotationText string `xml:",omitempty" json:"annotationText"`
+	Hash           string `json:"hash"`
+	Size           uint64 `json:"size"`
+	MimeType       string `xml:"Type" json:"mimeType"`
+	// Type is set from MimeType and isn't part of the XML
+	Type AssetType `xml:"-" json:"type"`
+}
+
+// pklXML wraps a PKL to read and write the namespace; used internally only
+type pklXML struct {
+	XMLName xml.Name
+	Xmlns   string `xml:"xmlns,attr"`
+	PKL
+	SignerXML *Signer `xml:"Signer,omitempty"`
 }
 
 // ParsePKLFile parses a PKL XML file, whose file path is asFilename
@@ -57,13 +77,30 @@ func ParsePKLFile(filename string) (*PKL, error) {
 	return ParsePKL(xmlStr)
 }
 
+// ParsePKLReader parses a PKL XML document read from r
+func ParsePKLReader(r io.Reader) (*PKL, error) {
+	xmlStr, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePKL(xmlStr)
+}
+
 // ParsePKL parses a PKL XML string
 func ParsePKL(xmlBytes []byte) (*PKL, error) {
-	var pkl PKL
-	err := xml.Unmarshal(xmlBytes, &pkl)
+	var pklXML pklXML
+	err := xml.Unmarshal(xmlBytes, &pklXML)
 	if err != nil {
 		return nil, err
 	}
+	pkl := pklXML.PKL
+	pkl.Signer = pklXML.SignerXML
+	pkl.raw = xmlBytes
+	if pklXML.Xmlns == interopPKLNamespace {
+		pkl.Format = INTEROP
+	} else if pklXML.Xmlns == smptePKLNamespace {
+		pkl.Format = SMPTE
+	}
 	// Assign correct types to assets
 	for _, asset := range pkl.Assets {
 		switch asset.MimeType {
@@ -77,3 +114,18 @@ func ParsePKL(xmlBytes []byte) (*PKL, error) {
 	}
 	return &pkl, nil
 }
+
+// MarshalPKL produces the PKL's XML document; the namespace is chosen
+// from the PKL's Format
+func MarshalPKL(pkl *PKL) ([]byte, error) {
+	pklXML := pklXML{XMLName: xml.Name{Local: "PackingList"}, PKL: *pkl}
+	switch pkl.Format {
+	case INTEROP:
+		pklXML.Xmlns = interopPKLNamespace
+	case SMPTE:
+		pklXML.Xmlns = smptePKLNamespace
+	default:
+		return nil, errors.New("Unable to marshal a PKL of unknown format")
+	}
+	return marshalXML(&pklXML)
+}
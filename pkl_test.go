@@ -18,6 +18,8 @@ package dcp
 import (
 	"testing"
 	"time"
+
+	"github.com/googlesamples/dcp/xmldsig"
 )
 
 // XML doc taken from DCPs available at http://www.freedcp.net
@@ -201,3 +203,51 @@ func TestPKL(t *testing.T) {
 			pkl.Assets[2].Type, CPLAssetType)
 	}
 }
+
+func TestPKLFormat(t *testing.T) {
+	pkl := parsePKL(t)
+	if pkl.Format != INTEROP {
+		t.Errorf("Format is incorrect: %d != %d", pkl.Format, INTEROP)
+	}
+}
+
+func TestMarshalPKL(t *testing.T) {
+	pkl := parsePKL(t)
+	pkl.AnnotationText = "Edited"
+	xmlStr, err := MarshalPKL(pkl)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	pkl2, err := ParsePKL(xmlStr)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if pkl2.Format != INTEROP {
+		t.Errorf("Format is incorrect: %d != %d", pkl2.Format, INTEROP)
+	}
+	if pkl2.AnnotationText != pkl.AnnotationText {
+		t.Errorf("AnnotationText is incorrect: %s != %s",
+			pkl2.AnnotationText, pkl.AnnotationText)
+	}
+	if len(pkl2.Assets) != len(pkl.Assets) {
+		t.Fatalf("Asset count is incorrect: %d != %d", len(pkl2.Assets), len(pkl.Assets))
+	}
+	for i, asset := range pkl2.Assets {
+		if *asset != *pkl.Assets[i] {
+			t.Errorf("Asset %d is incorrect: %v != %v", i, asset, pkl.Assets[i])
+		}
+	}
+}
+
+func TestPKLUnsigned(t *testing.T) {
+	pkl := parsePKL(t)
+	if pkl.Signer != nil {
+		t.Errorf("Unsigned PKL should have no Signer")
+	}
+	if _, err := pkl.VerifySignature(nil); err != xmldsig.ErrUnsigned {
+		t.Errorf("Unsigned PKL should return ErrUnsigned: %v", err)
+	}
+	if _, err := (&PKL{}).VerifySignature(nil); err == nil {
+		t.Errorf("PKL that wasn't parsed can't be verified")
+	}
+}
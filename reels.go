@@ -0,0 +1,174 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Integrity rules for the reels of a CPL: every asset must play within its
+essence, and the assets of a reel must share an edit rate and run for the
+same time, or picture and sound drift apart in projection
+*/
+
+package dcp
+
+import (
+	"fmt"
+)
+
+// Reel integrity codes
+const (
+	CodeAssetDurationInvalid Code = "ASSET_DURATION_INVALID"
+	CodeReelDurationMismatch Code = "REEL_DURATION_MISMATCH"
+	CodeEditRateInvalid      Code = "EDIT_RATE_INVALID"
+	CodeEditRateMismatch     Code = "EDIT_RATE_MISMATCH"
+)
+
+// cplRule checks a single CPL; file is the CPL's path, used in findings
+type cplRule func(report *Report, cpl *CPL, file string)
+
+// cplRules are run against every CPL of a DCP, and by ValidateCPL
+var cplRules = []cplRule{
+	checkAssetDurations,
+	checkEditRates,
+	checkReelDurations,
+	checkMarkers,
+}
+
+// ValidateCPL checks the reels of a CPL, reporting every problem found
+func ValidateCPL(cpl *CPL) *Report {
+	report := &Report{}
+	for _, rule := range cplRules {
+		rule(report, cpl, "")
+	}
+	return report
+}
+
+// checkCPLs runs the cplRules against each of the DCP's CPLs
+func checkCPLs(dcp *DCP, report *Report) {
+	for _, cpl := range dcp.CPLs {
+		file := firstPath(dcp.assetMapAsset(cpl.ID))
+		for _, rule := range cplRules {
+			rule(report, cpl, file)
+		}
+	}
+}
+
+// reelAsset is an asset of a reel, with the name of its element for messages
+type reelAsset struct {
+	element string
+	*Asset
+}
+
+// reelAssets returns the assets of a reel in the same order as Assets,
+// followed by the markers, which must run for as long as the reel too
+func (reel Reel) reelAssets() []reelAsset {
+	var assets []reelAsset
+	if reel.Picture != nil {
+		assets = append(assets, reelAsset{"MainPicture", &reel.Picture.Asset})
+	}
+	if reel.StereoscopicPicture != nil {
+		assets = append(assets, reelAsset{"MainStereoscopicPicture", &reel.StereoscopicPicture.Asset})
+	}
+	if reel.Sound != nil {
+		assets = append(assets, reelAsset{"MainSound", &reel.Sound.Asset})
+	}
+	if reel.Subtitle != nil {
+		assets = append(assets, reelAsset{"MainSubtitle", &reel.Subtitle.Asset})
+	}
+	if reel.Markers != nil {
+		assets = append(assets, reelAsset{"MainMarkers", &reel.Markers.Asset})
+	}
+	return assets
+}
+
+// mismatchSeverity is the severity of an asset disagreeing with the rest of
+// its reel; subtitles or markers out of step are a nuisance, picture and
+// sound aren't
+func (ra reelAsset) mismatchSeverity() Severity {
+	switch ra.element {
+	case "MainSubtitle", "MainMarkers":
+		return SeverityWarning
+	}
+	return SeverityError
+}
+
+// checkAssetDurations checks that each asset plays some of its essence, and
+// that EntryPoint plus Duration is within IntrinsicDuration
+func checkAssetDurations(report *Report, cpl *CPL, file string) {
+	for _, reel := range cpl.Reels {
+		for _, ra := range reel.reelAssets() {
+			switch {
+			case ra.Duration > 0 && ra.EntryPoint+ra.Duration > ra.IntrinsicDuration:
+				report.Add(SeverityError, CodeAssetDurationInvalid, file, ra.ID,
+					fmt.Sprintf("%s %s in reel %s: EntryPoint %d + Duration %d exceeds IntrinsicDuration %d",
+						ra.element, ra.ID, reel.ID, ra.EntryPoint, ra.Duration, ra.IntrinsicDuration))
+			case ra.playedDuration() == 0:
+				report.Add(SeverityError, CodeAssetDurationInvalid, file, ra.ID,
+					fmt.Sprintf("%s %s in reel %s plays nothing: EntryPoint %d, IntrinsicDuration %d",
+						ra.element, ra.ID, reel.ID, ra.EntryPoint, ra.IntrinsicDuration))
+			}
+		}
+	}
+}
+
+// checkEditRates checks that every asset has a valid edit rate, which ParseCPL
+// leaves unset if malformed, that the assets of a reel share one, and that
+// all reels run at the composition's rate
+func checkEditRates(report *Report, cpl *CPL, file string) {
+	cplRate := cpl.EditRate()
+	for _, reel := range cpl.Reels {
+		reelRate := reel.EditRate()
+		for i, ra := range reel.reelAssets() {
+			switch {
+			case !ra.EditRate.valid():
+				report.Add(SeverityError, CodeEditRateInvalid, file, ra.ID,
+					fmt.Sprintf("%s %s in reel %s has no valid EditRate", ra.element, ra.ID, reel.ID))
+			case i > 0 && reelRate.valid() && ra.EditRate != reelRate:
+				report.Add(ra.mismatchSeverity(), CodeEditRateMismatch, file, ra.ID,
+					fmt.Sprintf("%s %s in reel %s has EditRate %s, the reel's is %s",
+						ra.element, ra.ID, reel.ID, ra.EditRate, reelRate))
+			}
+		}
+		if reelRate.valid() && reelRate != cplRate {
+			report.Add(SeverityWarning, CodeEditRateMismatch, file, "",
+				fmt.Sprintf("Reel %s has EditRate %s, the composition's is %s",
+					reel.ID, reelRate, cplRate))
+		}
+	}
+}
+
+// checkReelDurations checks that the assets of each reel run for exactly
+// the same time as its first asset, normally the picture
+func checkReelDurations(report *Report, cpl *CPL, file string) {
+	for _, reel := range cpl.Reels {
+		assets := reel.reelAssets()
+		if len(assets) == 0 || !assets[0].EditRate.valid() {
+			continue
+		}
+		first := assets[0]
+		for _, ra := range assets[1:] {
+			if !ra.EditRate.valid() {
+				continue
+			}
+			// Compare units/rate exactly, as rates may differ
+			lhs := ra.playedDuration() * uint64(ra.EditRate.Denominator) * uint64(first.EditRate.Numerator)
+			rhs := first.playedDuration() * uint64(first.EditRate.Denominator) * uint64(ra.EditRate.Numerator)
+			if lhs != rhs {
+				report.Add(ra.mismatchSeverity(), CodeReelDurationMismatch, file, ra.ID,
+					fmt.Sprintf("%s %s in reel %s runs %d edit units at %s, %s %s runs %d at %s",
+						ra.element, ra.ID, reel.ID, ra.playedDuration(), ra.EditRate,
+						first.element, first.ID, first.playedDuration(), first.EditRate))
+			}
+		}
+	}
+}
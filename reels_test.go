@@ -0,0 +1,115 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"strings"
+	"testing"
+)
+
+// testReelCPL builds a single reel CPL with a picture and sound of 240
+// frames at 24fps, which modify then breaks
+func testReelCPL(modify func(reel *Reel)) *CPL {
+	reel := &Reel{
+		ID: "urn:uuid:reel",
+		Picture: &Picture{Asset: Asset{ID: "urn:uuid:picture", EditRate: EditRate{24, 1},
+			IntrinsicDuration: 240, Duration: 240}},
+		Sound: &Sound{Asset: Asset{ID: "urn:uuid:sound", EditRate: EditRate{24, 1},
+			IntrinsicDuration: 300, EntryPoint: 60}}}
+	if modify != nil {
+		modify(reel)
+	}
+	return &CPL{Reels: []*Reel{reel}}
+}
+
+func TestValidateCPL(t *testing.T) {
+	if report := ValidateCPL(testReelCPL(nil)); len(report.Findings) != 0 {
+		t.Errorf("Valid CPL reported: %v", report.Findings)
+	}
+	if report := ValidateCPL(parseCPL(t)); len(report.Findings) != 0 {
+		t.Errorf("Valid CPL reported: %v", report.Findings)
+	}
+}
+
+func TestCheckAssetDurations(t *testing.T) {
+	report := ValidateCPL(testReelCPL(func(reel *Reel) {
+		reel.Sound.Duration = 241
+	}))
+	findings := report.Filter(SeverityError)
+	if len(findings) == 0 || findings[0].Code != CodeAssetDurationInvalid ||
+		findings[0].AssetID != "urn:uuid:sound" {
+		t.Fatalf("Sound past its essence should be reported: %v", findings)
+	}
+	message := findings[0].Message
+	if !strings.Contains(message, "urn:uuid:reel") ||
+		!strings.Contains(message, "EntryPoint 60 + Duration 241 exceeds IntrinsicDuration 300") {
+		t.Errorf("Message is incorrect: %s", message)
+	}
+	report = ValidateCPL(testReelCPL(func(reel *Reel) {
+		reel.Sound.EntryPoint = 300
+	}))
+	if findings := report.Filter(SeverityError); len(findings) == 0 ||
+		findings[0].Code != CodeAssetDurationInvalid {
+		t.Errorf("Sound playing nothing should be reported: %v", findings)
+	}
+}
+
+func TestCheckReelDurations(t *testing.T) {
+	report := ValidateCPL(testReelCPL(func(reel *Reel) {
+		reel.Sound.EntryPoint = 61
+	}))
+	findings := report.Filter(SeverityError)
+	if len(findings) != 1 || findings[0].Code != CodeReelDurationMismatch ||
+		findings[0].AssetID != "urn:uuid:sound" {
+		t.Errorf("Sound shorter than the picture should be reported: %v", findings)
+	}
+	// The same running time at another edit rate is fine, apart from the rate
+	report = ValidateCPL(testReelCPL(func(reel *Reel) {
+		reel.Subtitle = &Subtitle{Asset: Asset{ID: "urn:uuid:subtitle",
+			EditRate: EditRate{48, 1}, IntrinsicDuration: 480}}
+	}))
+	if len(report.Findings) != 1 || report.Findings[0].Code != CodeEditRateMismatch ||
+		report.Findings[0].Severity != SeverityWarning {
+		t.Errorf("Only the subtitle's edit rate should be reported: %v", report.Findings)
+	}
+}
+
+func TestCheckEditRates(t *testing.T) {
+	cpl := testReelCPL(func(reel *Reel) {
+		reel.Sound.EditRate = EditRate{25, 1}
+		reel.Sound.IntrinsicDuration = 310
+	})
+	cpl.Reels = append(cpl.Reels, &Reel{ID: "urn:uuid:reel2",
+		Picture: &Picture{Asset: Asset{ID: "urn:uuid:picture2", IntrinsicDuration: 24}}})
+	var codes []Code
+	for _, f := range ValidateCPL(cpl).Findings {
+		codes = append(codes, f.Code)
+	}
+	// The sound's rate differs, the second picture has none
+	if len(codes) != 2 || codes[0] != CodeEditRateMismatch || codes[1] != CodeEditRateInvalid {
+		t.Errorf("Findings are incorrect: %v", codes)
+	}
+	// A malformed rate doesn't stop the CPL parsing, so it's reported
+	cpl, err := ParseCPL([]byte(strings.Replace(string(testCPLXML),
+		"<EditRate>24 1</EditRate>", "<EditRate>24/1</EditRate>", 1)))
+	if err != nil {
+		t.Fatalf("CPL with a malformed EditRate should parse: %s", err)
+	}
+	if findings := ValidateCPL(cpl).Filter(SeverityError); len(findings) != 1 ||
+		findings[0].Code != CodeEditRateInvalid {
+		t.Errorf("Malformed EditRate should be reported: %v", findings)
+	}
+}
@@ -0,0 +1,141 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Cross-referencing of CPL reel assets against the PKLs and the asset map
+*/
+
+package dcp
+
+// ResolvedAsset links an asset referenced by a CPL reel to its PKL entry
+// and its file in the asset map; PKLAsset is nil and Path is empty if the
+// reference couldn't be resolved
+type ResolvedAsset struct {
+	CPLID    string
+	ReelID   string
+	Asset    *Asset
+	PKLID    string
+	PKLAsset *PKLAsset
+	Path     string // path of the asset relative to the DCP root
+	Package  *DCP   // DCP holding the asset, which is an OV for a VF's assets
+}
+
+// Resolved reports whether the asset was found in both a PKL and the asset map
+func (ra ResolvedAsset) Resolved() bool {
+	return ra.PKLAsset != nil && ra.Path != ""
+}
+
+// Finding codes for cross-reference problems
+const (
+	CodeReelAssetNotInPKL      Code = "REEL_ASSET_NOT_IN_PKL"
+	CodeReelAssetNotInAssetMap Code = "REEL_ASSET_NOT_IN_ASSETMAP"
+	CodeAssetNotInPKL          Code = "ASSET_NOT_IN_PKL"
+	CodeCPLNotInPKL            Code = "CPL_NOT_IN_PKL"
+	CodeReelAssetHash          Code = "REEL_ASSET_HASH_MISMATCH"
+	CodeReelAssetExternal      Code = "REEL_ASSET_EXTERNAL"
+)
+
+// ResolveAssets finds the PKL entry and asset map path of every asset
+// referenced by the DCP's CPL reels
+func (dcp *DCP) ResolveAssets() []*ResolvedAsset {
+	var resolved []*ResolvedAsset
+	for _, cpl := range dcp.CPLs {
+		for _, reel := range cpl.Reels {
+			for _, asset := range reel.Assets() {
+				ra := &ResolvedAsset{CPLID: cpl.ID, ReelID: reel.ID, Asset: asset, Package: dcp}
+				if pkl, pklAsset := dcp.pklAsset(asset.ID); pklAsset != nil {
+					ra.PKLID = pkl.ID
+					ra.PKLAsset = pklAsset
+				}
+				ra.Path = firstPath(dcp.assetMapAsset(asset.ID))
+				resolved = append(resolved, ra)
+			}
+		}
+	}
+	return resolved
+}
+
+// pklAsset finds the PKL listing the asset with the given ID
+func (dcp *DCP) pklAsset(id string) (*PKL, *PKLAsset) {
+	for _, pkl := range dcp.PKLs {
+		for _, asset := range pkl.Assets {
+			if asset.ID == id {
+				return pkl, asset
+			}
+		}
+	}
+	return nil, nil
+}
+
+// assetMapAsset finds the asset with the given ID in the asset map
+func (dcp *DCP) assetMapAsset(id string) *AMAsset {
+	if dcp.AssetMap == nil {
+		return nil
+	}
+	return dcp.AssetMap.Asset(id)
+}
+
+/*
+checkCrossReferences reports reel assets missing from the PKLs or the asset
+map or whose hash differs from the PKL's, asset map entries in no PKL and
+CPLs in no PKL. If the DCP is a VF, reel assets missing from both are taken
+to be held by an OV and only warned about, as CheckVF resolves them
+*/
+func checkCrossReferences(dcp *DCP, report *Report) {
+	for _, ra := range dcp.ResolveAssets() {
+		if dcp.VF && ra.PKLAsset == nil && ra.Path == "" {
+			report.Add(SeverityWarning, CodeReelAssetExternal, "", ra.Asset.ID,
+				"Asset in reel "+ra.ReelID+" of CPL "+ra.CPLID+
+					" is in neither the PKLs nor the assetmap, so must be in an OV")
+			continue
+		}
+		if ra.PKLAsset == nil {
+			report.Add(SeverityError, CodeReelAssetNotInPKL, ra.Path, ra.Asset.ID,
+				"Asset in reel "+ra.ReelID+" of CPL "+ra.CPLID+" is not in any PKL")
+		} else if ra.Asset.Hash != "" && ra.Asset.Hash != ra.PKLAsset.Hash {
+			report.Add(SeverityError, CodeReelAssetHash, ra.Path, ra.Asset.ID,
+				"Hash in reel "+ra.ReelID+" of CPL "+ra.CPLID+" does not match the PKL: "+
+					ra.Asset.Hash+" != "+ra.PKLAsset.Hash)
+		}
+		if ra.Path == "" {
+			report.Add(SeverityError, CodeReelAssetNotInAssetMap, "", ra.Asset.ID,
+				"Asset in reel "+ra.ReelID+" of CPL "+ra.CPLID+" is not in the assetmap")
+		}
+	}
+	for _, asset := range dcp.AssetMap.Assets {
+		if asset.Type == PKLAssetType {
+			// PKLs list the other assets, not themselves
+			continue
+		}
+		if _, pklAsset := dcp.pklAsset(asset.ID); pklAsset == nil {
+			report.Add(SeverityWarning, CodeAssetNotInPKL, firstPath(asset), asset.ID,
+				"Asset is in the assetmap but not in any PKL")
+		}
+	}
+	for _, cpl := range dcp.CPLs {
+		if _, pklAsset := dcp.pklAsset(cpl.ID); pklAsset == nil {
+			report.Add(SeverityError, CodeCPLNotInPKL, firstPath(dcp.assetMapAsset(cpl.ID)),
+				cpl.ID, "CPL is not in any PKL")
+		}
+	}
+}
+
+// firstPath returns the path of an asset's first chunk, or an empty string
+func firstPath(asset *AMAsset) string {
+	if asset == nil || len(asset.Chunks) == 0 {
+		return ""
+	}
+	return asset.Chunks[0].Path
+}
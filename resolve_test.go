@@ -0,0 +1,96 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"testing"
+)
+
+// makeResolveDCP builds a DCP from the test documents, with the sound asset
+// dropped from the PKL
+func makeResolveDCP(t *testing.T) *DCP {
+	pkl := parsePKL(t)
+	pkl.Assets = append(pkl.Assets[:1], pkl.Assets[2:]...)
+	return &DCP{
+		AssetMap: parseAM(t),
+		CPLs:     []*CPL{parseCPL(t)},
+		PKLs:     []*PKL{pkl},
+	}
+}
+
+func TestResolveAssets(t *testing.T) {
+	dcp := makeResolveDCP(t)
+	resolved := dcp.ResolveAssets()
+	if len(resolved) != 2 {
+		t.Fatalf("Resolved asset count is incorrect: %d != %d", len(resolved), 2)
+	}
+	picture := resolved[0]
+	if !picture.Resolved() {
+		t.Errorf("Picture asset should be resolved")
+	}
+	expectedPath := "bewegte_bilder-tricks17-test_film-full_content-51-j2k_video.mxf"
+	if picture.Path != expectedPath {
+		t.Errorf("Picture path is incorrect: %s != %s", picture.Path, expectedPath)
+	}
+	expectedID := "urn:uuid:4d9e98c3-c923-4910-ae0e-9f5951c9cc5f"
+	if picture.PKLID != expectedID {
+		t.Errorf("Picture PKL id is incorrect: %s != %s", picture.PKLID, expectedID)
+	}
+	sound := resolved[1]
+	if sound.Resolved() || sound.PKLAsset != nil || sound.Path == "" {
+		t.Errorf("Sound asset should be in the assetmap but not the PKL")
+	}
+}
+
+func TestCheckCrossReferences(t *testing.T) {
+	dcp := makeResolveDCP(t)
+	report := &Report{}
+	checkCrossReferences(dcp, report)
+	soundID := "urn:uuid:5fbb3067-4166-4a19-9ba2-0a2b4c5cd397"
+	var codes []Code
+	for _, f := range report.Findings {
+		if f.AssetID != soundID {
+			t.Errorf("Unexpected finding for %s: %s", f.AssetID, f.Code)
+		}
+		codes = append(codes, f.Code)
+	}
+	if len(codes) != 2 || codes[0] != CodeReelAssetNotInPKL || codes[1] != CodeAssetNotInPKL {
+		t.Errorf("Findings are incorrect: %v", codes)
+	}
+	// Dropping the CPL from the PKL is reported too
+	dcp.PKLs[0].Assets = dcp.PKLs[0].Assets[:1]
+	report = &Report{}
+	checkCrossReferences(dcp, report)
+	if len(report.Filter(SeverityError)) != 2 ||
+		report.Filter(SeverityError)[1].Code != CodeCPLNotInPKL {
+		t.Errorf("CPL missing from the PKL should be reported")
+	}
+}
+
+func TestCheckCrossReferencesHash(t *testing.T) {
+	cpl, err := ParseCPL(testEncryptedCPLXML)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	dcp := &DCP{AssetMap: parseAM(t), CPLs: []*CPL{cpl}, PKLs: []*PKL{parsePKL(t)}}
+	report := &Report{}
+	checkCrossReferences(dcp, report)
+	// The test CPL gives both assets the picture's hash
+	if len(report.Findings) != 1 || report.Findings[0].Code != CodeReelAssetHash ||
+		report.Findings[0].AssetID != "urn:uuid:5fbb3067-4166-4a19-9ba2-0a2b4c5cd397" {
+		t.Errorf("Sound hash mismatch should be reported: %v", report.Findings)
+	}
+}
@@ -0,0 +1,206 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Signature verification of CPLs and PKLs
+*/
+
+package dcp
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/googlesamples/dcp/xmldsig"
+)
+
+// Signer identifies the certificate that signed a CPL or PKL
+type Signer struct {
+	IssuerName   string `xml:"X509Data>X509IssuerSerial>X509IssuerName" json:"issuerName"`
+	SerialNumber string `xml:"X509Data>X509IssuerSerial>X509SerialNumber" json:"serialNumber"`
+	SubjectName  string `xml:"X509Data>X509SubjectName" json:"subjectName"`
+}
+
+/*
+VerifySignature checks the CPL's enveloped signature and returns the
+signer's certificate chain; unsigned CPLs return xmldsig.ErrUnsigned. The
+chain must lead to one of roots; if roots is nil only its structure is
+checked, which doesn't authenticate the signer. The certificates must have
+been valid at the CPL's IssueDate
+*/
+func (cpl *CPL) VerifySignature(roots *x509.CertPool) ([]*x509.Certificate, error) {
+	return verifySignature(xmldsig.VerifyDocument, cpl.raw, cpl.Signer,
+		xmldsig.Options{Roots: roots, Time: cpl.IssueDate})
+}
+
+// VerifySignature checks the PKL's enveloped signature as CPL's
+// VerifySignature does; unsigned PKLs return xmldsig.ErrUnsigned
+func (pkl *PKL) VerifySignature(roots *x509.CertPool) ([]*x509.Certificate, error) {
+	return verifySignature(xmldsig.VerifyDocument, pkl.raw, pkl.Signer,
+		xmldsig.Options{Roots: roots, Time: pkl.IssueDate})
+}
+
+// verifySignature verifies a signed document with verify and checks the
+// signing certificate is the one named in the Signer block
+func verifySignature(verify func([]byte, xmldsig.Options) ([]*x509.Certificate, error),
+	raw []byte, signer *Signer, opts xmldsig.Options) ([]*x509.Certificate, error) {
+	if raw == nil {
+		return nil, errors.New("No XML document to verify; only parsed documents can be verified")
+	}
+	chain, err := verify(raw, opts)
+	if err != nil {
+		return nil, err
+	}
+	if signer != nil && signer.SerialNumber != "" &&
+		strings.TrimSpace(signer.SerialNumber) != chain[0].SerialNumber.String() {
+		return nil, errors.New("Signer does not match the signing certificate")
+	}
+	// Serial numbers are only unique to an issuer
+	if signer != nil && signer.IssuerName != "" &&
+		!equalNames(parseDN(signer.IssuerName), nameAttributes(chain[0].Issuer)) {
+		return nil, errors.New("Signer issuer does not match the signing certificate: " +
+			signer.IssuerName)
+	}
+	return chain, nil
+}
+
+// dnAttributeNames are the names of the attribute types found in the
+// distinguished names of DCI certificates, by OID
+var dnAttributeNames = map[string]string{
+	"2.5.4.3":  "cn",
+	"2.5.4.5":  "serialnumber",
+	"2.5.4.6":  "c",
+	"2.5.4.7":  "l",
+	"2.5.4.8":  "st",
+	"2.5.4.10": "o",
+	"2.5.4.11": "ou",
+	"2.5.4.46": "dnqualifier",
+}
+
+/*
+parseDN splits a distinguished name written as RFC 4514 text, such as
+"dnQualifier=8O8g\+cK\=,CN=.root.example.com,O=example.com", into type=value
+attributes; types are lower case names and values are unescaped
+*/
+func parseDN(dn string) []string {
+	var attrs []string
+	var attrType, value strings.Builder
+	inValue := false
+	flush := func() {
+		if inValue {
+			attrs = append(attrs, dnAttribute(attrType.String(), strings.TrimSpace(value.String())))
+		}
+		attrType.Reset()
+		value.Reset()
+		inValue = false
+	}
+	for i := 0; i < len(dn); i++ {
+		cur := &attrType
+		if inValue {
+			cur = &value
+		}
+		switch c := dn[i]; {
+		case c == '\\' && i+2 < len(dn) && isHex(dn[i+1]) && isHex(dn[i+2]):
+			b, _ := hex.DecodeString(dn[i+1 : i+3])
+			cur.Write(b)
+			i += 2
+		case c == '\\' && i+1 < len(dn):
+			cur.WriteByte(dn[i+1])
+			i++
+		case c == '=' && !inValue:
+			inValue = true
+		case c == ',' || c == '+' || c == ';':
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return attrs
+}
+
+// nameAttributes lists the type=value attributes of a certificate name
+func nameAttributes(name pkix.Name) []string {
+	var attrs []string
+	for _, atv := range name.Names {
+		attrs = append(attrs, dnAttribute(atv.Type.String(), fmt.Sprint(atv.Value)))
+	}
+	return attrs
+}
+
+// dnAttribute writes an attribute with its type as a lower case name
+func dnAttribute(attrType, value string) string {
+	attrType = strings.ToLower(strings.TrimSpace(attrType))
+	if name, ok := dnAttributeNames[strings.TrimPrefix(attrType, "oid.")]; ok {
+		attrType = name
+	}
+	return attrType + "=" + value
+}
+
+// equalNames compares two lists of attributes, in any order
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// Finding codes for signature problems
+const (
+	CodeUnsigned         Code = "UNSIGNED"
+	CodeSignatureInvalid Code = "SIGNATURE_INVALID"
+)
+
+// checkSignatures reports CPLs and PKLs that are unsigned or whose
+// signature doesn't verify against the DCP's Roots; SMPTE documents are
+// expected to be signed
+func checkSignatures(dcp *DCP, report *Report) {
+	check := func(id string, format Format,
+		verify func(*x509.CertPool) ([]*x509.Certificate, error)) {
+		_, err := verify(dcp.Roots)
+		switch {
+		case err == xmldsig.ErrUnsigned && format == SMPTE:
+			report.Add(SeverityWarning, CodeUnsigned, firstPath(dcp.assetMapAsset(id)), id,
+				"SMPTE document is not signed")
+		case err == xmldsig.ErrUnsigned:
+		case err != nil:
+			report.Add(SeverityError, CodeSignatureInvalid, firstPath(dcp.assetMapAsset(id)), id,
+				err.Error())
+		}
+	}
+	for _, cpl := range dcp.CPLs {
+		check(cpl.ID, cpl.Format, cpl.VerifySignature)
+	}
+	for _, pkl := range dcp.PKLs {
+		check(pkl.ID, pkl.Format, pkl.VerifySignature)
+	}
+}
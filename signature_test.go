@@ -0,0 +1,46 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"reflect"
+	"testing"
+)
+
+func TestParseDN(t *testing.T) {
+	dn := `dnQualifier=8O8g\+cK\=,CN = .root.example.com,O=example\2Ccom`
+	expected := []string{"dnqualifier=8O8g+cK=", "cn=.root.example.com", "o=example,com"}
+	if attrs := parseDN(dn); !reflect.DeepEqual(attrs, expected) {
+		t.Errorf("Attributes are incorrect: %v != %v", attrs, expected)
+	}
+	name := pkix.Name{Names: []pkix.AttributeTypeAndValue{
+		{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: "example,com"},
+		{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: ".root.example.com"},
+		{Type: asn1.ObjectIdentifier{2, 5, 4, 46}, Value: "8O8g+cK="},
+	}}
+	// The order of attributes doesn't matter
+	if !equalNames(parseDN(dn), nameAttributes(name)) {
+		t.Errorf("Names should be equal: %v, %v", parseDN(dn), nameAttributes(name))
+	}
+	if equalNames(parseDN("CN=.root.example.com,O=example\\2Ccom"), nameAttributes(name)) {
+		t.Errorf("Names with different attributes should not be equal")
+	}
+	if equalNames(parseDN(`dnQualifier=other,CN=.root.example.com,O=example\,com`), nameAttributes(name)) {
+		t.Errorf("Names with different values should not be equal")
+	}
+}
@@ -0,0 +1,242 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Splitting a DCP across delivery volumes, such as drives of a fixed size;
+MXF assets that don't fit on a volume are split into chunks that carry on
+on the next one
+*/
+
+package dcp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/*
+PlanVolumes lays the DCP's assets out over as many volumes of capacity bytes
+as needed, returning the assetmap written to every volume. Assets other than
+MXFs, such as the CPLs and PKLs, are kept whole and go first, so they're on
+the first volume
+*/
+func (dcp *DCP) PlanVolumes(capacity uint64) (*AssetMap, error) {
+	if dcp.AssetMap == nil {
+		return nil, errors.New("DCP has no assetmap")
+	}
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	am := &AssetMap{
+		Format:    dcp.AssetMap.Format,
+		ID:        id,
+		Creator:   dcp.AssetMap.Creator,
+		Issuer:    dcp.AssetMap.Issuer,
+		IssueDate: time.Now().UTC().Truncate(time.Second)}
+	sizes := map[string]uint64{}
+	for _, asset := range dcp.AssetMap.Assets {
+		if sizes[asset.ID], err = dcp.assetSize(asset); err != nil {
+			return nil, err
+		}
+	}
+	// Every volume holds the assetmap and a VOLINDEX, which grow with the
+	// number of chunks, so the layout is redone until enough space is left
+	// for them
+	var reserved uint64
+	for {
+		if err := dcp.layoutVolumes(am, sizes, capacity, reserved); err != nil {
+			return nil, err
+		}
+		needed, err := volumeOverhead(am)
+		if err != nil {
+			return nil, err
+		}
+		if needed <= reserved {
+			return am, nil
+		}
+		reserved = needed
+	}
+}
+
+// layoutVolumes fills the assets of am with chunks, leaving reserved bytes
+// free on each volume
+func (dcp *DCP) layoutVolumes(am *AssetMap, sizes map[string]uint64, capacity, reserved uint64) error {
+	if reserved >= capacity {
+		return fmt.Errorf("Volume capacity of %d bytes is too small", capacity)
+	}
+	space := capacity - reserved
+	volume, free := 1, space
+	am.Assets = nil
+	place := func(asset *AMAsset, split bool) error {
+		path := asset.Chunks[0].Path
+		size := sizes[asset.ID]
+		if !split && size > free {
+			if size > space {
+				return fmt.Errorf("%s is too large for a volume: %d bytes", path, size)
+			}
+			volume, free = volume+1, space
+		}
+		placed := &AMAsset{ID: asset.ID, Type: asset.Type}
+		var offset uint64
+		for {
+			if free == 0 {
+				volume, free = volume+1, space
+			}
+			chunk := &Chunk{Path: path, VolumeIndex: volume, Offset: offset, Size: size - offset}
+			if chunk.Size > free {
+				chunk.Size = free
+			}
+			placed.Chunks = append(placed.Chunks, chunk)
+			offset += chunk.Size
+			free -= chunk.Size
+			if offset == size {
+				break
+			}
+		}
+		am.Assets = append(am.Assets, placed)
+		return nil
+	}
+	for _, split := range []bool{false, true} {
+		for _, asset := range dcp.AssetMap.Assets {
+			if len(asset.Chunks) == 0 || mxfRegExp.MatchString(asset.Chunks[0].Path) != split {
+				continue
+			}
+			if err := place(asset, split); err != nil {
+				return err
+			}
+		}
+	}
+	if volume > 255 {
+		return fmt.Errorf("DCP needs %d volumes, more than an assetmap can hold", volume)
+	}
+	am.VolumeCount = uint8(volume)
+	return nil
+}
+
+// volumeOverhead returns the space taken on each volume by the assetmap and
+// the largest VOLINDEX
+func volumeOverhead(am *AssetMap) (uint64, error) {
+	amXML, err := MarshalAssetMap(am)
+	if err != nil {
+		return 0, err
+	}
+	viXML, err := MarshalVolumeIndex(&VolumeIndex{am.Format, int(am.VolumeCount)})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(amXML) + len(viXML)), nil
+}
+
+// assetSize returns the size of an asset's files, which may differ from the
+// lengths in the assetmap, where they're optional
+func (dcp *DCP) assetSize(asset *AMAsset) (uint64, error) {
+	var size uint64
+	for _, chunk := range asset.Chunks {
+		file, err := dcp.openChunk(chunk)
+		if err != nil {
+			return 0, err
+		}
+		info, err := file.Stat()
+		file.Close()
+		if err != nil {
+			return 0, err
+		}
+		size += uint64(info.Size())
+	}
+	return size, nil
+}
+
+/*
+WriteVolumes copies the DCP's assets into the root directories of the
+volumes planned by PlanVolumes, one directory per volume in order of index,
+and writes each volume's assetmap and VOLINDEX
+*/
+func (dcp *DCP) WriteVolumes(am *AssetMap, dirs ...string) error {
+	if len(dirs) != int(am.VolumeCount) {
+		return fmt.Errorf("%d directories given for %d volumes", len(dirs), am.VolumeCount)
+	}
+	amXML, err := MarshalAssetMap(am)
+	if err != nil {
+		return err
+	}
+	amFileName, viFileName := "ASSETMAP", "VOLINDEX"
+	if am.Format == SMPTE {
+		amFileName, viFileName = amFileName+".xml", viFileName+".xml"
+	}
+	for i, dir := range dirs {
+		viXML, err := MarshalVolumeIndex(&VolumeIndex{am.Format, i + 1})
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, amFileName), amXML, 0644); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, viFileName), viXML, 0644); err != nil {
+			return err
+		}
+	}
+	for _, asset := range am.Assets {
+		if err := dcp.writeChunks(asset, dirs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChunks copies an asset into the files of its planned chunks
+func (dcp *DCP) writeChunks(asset *AMAsset, dirs []string) error {
+	source := dcp.AssetMap.Asset(asset.ID)
+	if source == nil {
+		return errors.New("Asset " + asset.ID + " is not in the assetmap")
+	}
+	r, err := dcp.AssetReader(source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	chunks := append([]*Chunk{}, asset.Chunks...)
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Offset < chunks[j].Offset })
+	for _, chunk := range chunks {
+		if chunk.Volume() > len(dirs) {
+			return fmt.Errorf("%s is on volume %d of %d", chunk.Path, chunk.Volume(), len(dirs))
+		}
+		name := filepath.Join(dirs[chunk.Volume()-1], filepath.FromSlash(fsName(chunk.Path)))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		file, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(file, r, int64(chunk.Size))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("Writing %s: %s", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitVolumes(t *testing.T) {
+	vol1, vol2, picture := testVolumes()
+	dcp, err := OpenVolumesFS(vol1, vol2)
+	if err != nil {
+		t.Fatalf("Error opening volumes: %s", err)
+	}
+	const capacity = 1700
+	am, err := dcp.PlanVolumes(capacity)
+	if err != nil {
+		t.Fatalf("Error planning volumes: %s", err)
+	}
+	if am.VolumeCount != 2 {
+		t.Errorf("Volume count is incorrect: %d != 2", am.VolumeCount)
+	}
+	if am.ID == dcp.AssetMap.ID {
+		t.Error("Split DCP should have a new assetmap ID")
+	}
+	pkl := am.Asset("urn:uuid:4d9e98c3-c923-4910-ae0e-9f5951c9cc5f")
+	if len(pkl.Chunks) != 1 || pkl.Chunks[0].Volume() != 1 {
+		t.Errorf("PKL should be whole on volume 1: %+v", pkl.Chunks)
+	}
+	video := am.Asset("urn:uuid:db95199c-0e2f-4ac4-9e54-b97919dcdf07")
+	if len(video.Chunks) != 2 || video.Size() != uint64(len(picture)) {
+		t.Errorf("Picture should be split in two: %+v", video.Chunks)
+	}
+
+	root, err := ioutil.TempDir("", "dcp")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(root)
+	dirs := []string{filepath.Join(root, "VOL1"), filepath.Join(root, "VOL2")}
+	if err := dcp.WriteVolumes(am, dirs...); err != nil {
+		t.Fatalf("Error writing volumes: %s", err)
+	}
+	for i, dir := range dirs {
+		var used int64
+		files, _ := ioutil.ReadDir(dir)
+		for _, f := range files {
+			used += f.Size()
+		}
+		if used > capacity {
+			t.Errorf("Volume %d is over capacity: %d bytes", i+1, used)
+		}
+	}
+
+	split := &DCP{}
+	report := split.ValidateVolumes(dirs...)
+	if len(report.Findings) != 0 {
+		t.Errorf("Split DCP should be valid: %v", report.Findings)
+	}
+	CheckHashes(split, report)
+	if len(report.Findings) != 0 {
+		t.Errorf("Hashes of the split DCP should match: %v", report.Findings)
+	}
+	r, err := split.AssetReader(split.AssetMap.Asset(video.ID))
+	if err != nil {
+		t.Fatalf("Error reading asset: %s", err)
+	}
+	defer r.Close()
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, picture) {
+		t.Errorf("Split asset is incorrect: %d bytes", len(data))
+	}
+}
+
+func TestPlanVolumesTooSmall(t *testing.T) {
+	vol1, vol2, _ := testVolumes()
+	dcp, err := OpenVolumesFS(vol1, vol2)
+	if err != nil {
+		t.Fatalf("Error opening volumes: %s", err)
+	}
+	// The assetmap doesn't fit, nor the PKL, which can't be split
+	for _, capacity := range []uint64{100, 1300} {
+		if _, err := dcp.PlanVolumes(capacity); err == nil {
+			t.Errorf("DCP planned on volumes of %d bytes", capacity)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Subtitle document structs and associated functions, for Interop DCSubtitle
+and SMPTE ST 428-7 SubtitleReel documents
+*/
+
+package dcp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/googlesamples/dcp/mxf"
+)
+
+// interopTickRate is the number of ticks per second in Interop subtitle times
+const interopTickRate = 250
+
+// SubtitleReel is a parsed subtitle document
+type SubtitleReel struct {
+	Format           Format
+	ID               string
+	ContentTitleText string    // MovieTitle in Interop documents
+	IssueDate        time.Time // SMPTE only
+	ReelNumber       int
+	Language         string
+	EditRate         EditRate // SMPTE only
+	TimeCodeRate     int      // ticks per second of the document's times
+	StartTime        time.Duration
+	LoadFonts        []*LoadFont
+	Spots            []*SubtitleSpot
+}
+
+// LoadFont is a font used by the subtitles; URI is a file name in Interop
+// documents and a urn:uuid resource ID in SMPTE documents
+type LoadFont struct {
+	ID  string
+	URI string
+}
+
+// SubtitleSpot is a single subtitle; times are relative to the start of
+// the reel
+type SubtitleSpot struct {
+	SpotNumber   int
+	TimeIn       time.Duration
+	TimeOut      time.Duration
+	FadeUpTime   time.Duration
+	FadeDownTime time.Duration
+	Texts        []*SubtitleText
+	Images       []*SubtitleImage
+}
+
+// Placement is the position of a subtitle text or image on screen
+type Placement struct {
+	HAlign    string
+	HPosition float64
+	VAlign    string
+	VPosition float64
+	Direction string
+}
+
+// SubtitleText is a line of subtitle text, made of differently styled runs
+type SubtitleText struct {
+	Placement
+	Runs []*TextRun
+}
+
+// String returns the text without styling
+func (t SubtitleText) String() string {
+	var s string
+	for _, run := range t.Runs {
+		s += run.Text
+	}
+	return s
+}
+
+// TextRun is a piece of text with a single font style
+type TextRun struct {
+	Text string
+	Font FontStyle
+}
+
+// SubtitleImage is a subtitle rendered as a PNG; Ref is a file name in
+// Interop documents and a urn:uuid resource ID in SMPTE documents
+type SubtitleImage struct {
+	Placement
+	Ref string
+}
+
+// FontStyle is the styling of subtitle text, inherited from enclosing Font
+// elements
+type FontStyle struct {
+	ID          string
+	Size        int
+	Color       string // ARGB hex, e.g. FFFFFFFF
+	Italic      bool
+	Bold        bool
+	Underline   bool
+	Effect      string // none, border or shadow
+	EffectColor string
+	Script      string // normal, super or sub
+}
+
+// ParseSubtitleReelFile parses a subtitle file, whose file path is
+// filename; SMPTE subtitles wrapped in an MXF track file are unwrapped
+func ParseSubtitleReelFile(filename string) (*SubtitleReel, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseSubtitleReelReader(file)
+}
+
+// ParseSubtitleReelReader parses a subtitle document read from r; SMPTE
+// subtitles wrapped in an MXF track file are unwrapped
+func ParseSubtitleReelReader(r io.Reader) (*SubtitleReel, error) {
+	xmlStr, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// SMPTE subtitle track files start with a KLV key rather than XML
+	if bytes.HasPrefix(xmlStr, mxfHeader[:4]) {
+		if xmlStr, err = mxf.ReadTimedText(bytes.NewReader(xmlStr)); err != nil {
+			return nil, err
+		}
+	}
+	return ParseSubtitleReel(xmlStr)
+}
+
+// SubtitleReel parses the subtitle document of a CPL subtitle asset, found
+// through the asset map
+func (dcp *DCP) SubtitleReel(subtitle *Subtitle) (*SubtitleReel, error) {
+	asset := dcp.assetMapAsset(subtitle.ID)
+	if firstPath(asset) == "" {
+		return nil, errors.New("Asset " + subtitle.ID + " is not in the assetmap")
+	}
+	file, err := dcp.AssetReader(asset)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseSubtitleReelReader(file)
+}
+
+// ParseSubtitleReel parses an Interop or SMPTE subtitle XML string
+func ParseSubtitleReel(xmlStr []byte) (*SubtitleReel, error) {
+	p := &subtitleParser{reel: &SubtitleReel{}}
+	d := xml.NewDecoder(bytes.NewReader(xmlStr))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			err = p.start(t)
+		case xml.EndElement:
+			err = p.end(t)
+		case xml.CharData:
+			p.text = append(p.text, t...)
+			if p.textLine != nil {
+				p.textLine.Runs = append(p.textLine.Runs,
+					&TextRun{string(t), p.fonts[len(p.fonts)-1]})
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.reel.Format == UNKNOWN {
+		return nil, errors.New("Not a DCSubtitle or SubtitleReel document")
+	}
+	return p.reel, nil
+}
+
+// subtitleParser holds the state while reading a subtitle document
+type subtitleParser struct {
+	reel     *SubtitleReel
+	depth    int
+	fonts    []FontStyle // styles of the enclosing Font elements
+	spot     *SubtitleSpot
+	textLine *SubtitleText
+	image    *SubtitleImage
+	loadFont *LoadFont
+	text     []byte // character data of the current element
+}
+
+// start handles a start element
+func (p *subtitleParser) start(t xml.StartElement) error {
+	p.depth++
+	p.text = nil
+	if p.depth == 1 {
+		switch t.Name.Local {
+		case "DCSubtitle":
+			p.reel.Format = INTEROP
+			p.reel.TimeCodeRate = interopTickRate
+		case "SubtitleReel":
+			p.reel.Format = SMPTE
+		}
+		p.fonts = []FontStyle{{}}
+		return nil
+	}
+	switch t.Name.Local {
+	case "LoadFont":
+		p.loadFont = &LoadFont{ID: attr(t, "Id"), URI: attr(t, "URI")}
+		p.reel.LoadFonts = append(p.reel.LoadFonts, p.loadFont)
+	case "Font":
+		font, err := fontStyle(p.fonts[len(p.fonts)-1], t)
+		if err != nil {
+			return err
+		}
+		p.fonts = append(p.fonts, font)
+	case "Subtitle":
+		spot, err := p.subtitleSpot(t)
+		if err != nil {
+			return err
+		}
+		p.spot = spot
+		p.reel.Spots = append(p.reel.Spots, spot)
+	case "Text":
+		if p.spot == nil {
+			return errors.New("Text outside of a Subtitle")
+		}
+		p.textLine = &SubtitleText{Placement: placement(t)}
+		p.spot.Texts = append(p.spot.Texts, p.textLine)
+	case "Image":
+		if p.spot == nil {
+			return errors.New("Image outside of a Subtitle")
+		}
+		p.image = &SubtitleImage{Placement: placement(t)}
+		p.spot.Images = append(p.spot.Images, p.image)
+	}
+	return nil
+}
+
+// end handles an end element, storing the text of simple elements
+func (p *subtitleParser) end(t xml.EndElement) error {
+	defer func() { p.depth-- }()
+	text := strings.TrimSpace(string(p.text))
+	var err error
+	switch t.Name.Local {
+	case "SubtitleID", "Id":
+		p.reel.ID = text
+	case "MovieTitle", "ContentTitleText":
+		p.reel.ContentTitleText = text
+	case "IssueDate":
+		p.reel.IssueDate, err = time.Parse(time.RFC3339, text)
+	case "ReelNumber":
+		p.reel.ReelNumber, err = strconv.Atoi(text)
+	case "Language":
+		p.reel.Language = text
+	case "EditRate":
+		p.reel.EditRate, err = ParseEditRate(text)
+	case "TimeCodeRate":
+		p.reel.TimeCodeRate, err = strconv.Atoi(text)
+	case "StartTime":
+		p.reel.StartTime, err = parseSubtitleTime(text, p.reel.TimeCodeRate)
+	case "LoadFont":
+		if p.loadFont != nil && p.loadFont.URI == "" {
+			p.loadFont.URI = text
+		}
+		p.loadFont = nil
+	case "Font":
+		p.fonts = p.fonts[:len(p.fonts)-1]
+	case "Subtitle":
+		p.spot = nil
+	case "Text":
+		p.textLine = nil
+	case "Image":
+		if p.image != nil {
+			p.image.Ref = text
+		}
+		p.image = nil
+	}
+	return err
+}
+
+// subtitleSpot reads the attributes of a Subtitle element
+func (p *subtitleParser) subtitleSpot(t xml.StartElement) (*SubtitleSpot, error) {
+	if p.reel.TimeCodeRate <= 0 {
+		return nil, errors.New("TimeCodeRate must be set before the subtitles")
+	}
+	spot := &SubtitleSpot{}
+	spot.SpotNumber, _ = strconv.Atoi(attr(t, "SpotNumber"))
+	times := []struct {
+		name   string
+		value  *time.Duration
+		offset bool // relative to the reel's StartTime
+	}{
+		{"TimeIn", &spot.TimeIn, true},
+		{"TimeOut", &spot.TimeOut, true},
+		{"FadeUpTime", &spot.FadeUpTime, false},
+		{"FadeDownTime", &spot.FadeDownTime, false},
+	}
+	for _, tt := range times {
+		value := attr(t, tt.name)
+		if value == "" {
+			continue
+		}
+		d, err := parseSubtitleTime(value, p.reel.TimeCodeRate)
+		if err != nil {
+			return nil, err
+		}
+		if tt.offset {
+			d -= p.reel.StartTime
+		}
+		*tt.value = d
+	}
+	return spot, nil
+}
+
+// attr returns the value of an attribute, ignoring case since Interop and
+// SMPTE documents spell some attributes differently (e.g. VAlign, Valign)
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// fontStyle applies the attributes of a Font element to the enclosing style
+func fontStyle(parent FontStyle, t xml.StartElement) (FontStyle, error) {
+	font := parent
+	for _, a := range t.Attr {
+		switch strings.ToLower(a.Name.Local) {
+		case "id":
+			font.ID = a.Value
+		case "size":
+			size, err := strconv.Atoi(a.Value)
+			if err != nil {
+				return font, err
+			}
+			font.Size = size
+		case "color":
+			font.Color = a.Value
+		case "italic":
+			font.Italic = a.Value == "yes"
+		case "weight":
+			font.Bold = a.Value == "bold"
+		case "underline", "underlined":
+			font.Underline = a.Value == "yes"
+		case "effect":
+			font.Effect = a.Value
+		case "effectcolor":
+			font.EffectColor = a.Value
+		case "script":
+			font.Script = a.Value
+		}
+	}
+	return font, nil
+}
+
+// placement reads the position attributes of a Text or Image element
+func placement(t xml.StartElement) Placement {
+	p := Placement{
+		HAlign:    attr(t, "HAlign"),
+		VAlign:    attr(t, "VAlign"),
+		Direction: attr(t, "Direction")}
+	p.HPosition, _ = strconv.ParseFloat(attr(t, "HPosition"), 64)
+	p.VPosition, _ = strconv.ParseFloat(attr(t, "VPosition"), 64)
+	return p
+}
+
+/*
+parseSubtitleTime parses a subtitle time: HH:MM:SS:TT where TT counts ticks
+at rate per second, HH:MM:SS.sss, or a bare tick count as used by Interop
+fade times
+*/
+func parseSubtitleTime(s string, rate int) (time.Duration, error) {
+	tickDuration := func(ticks int) time.Duration {
+		return time.Duration(ticks) * time.Second / time.Duration(rate)
+	}
+	fields := strings.Split(s, ":")
+	if len(fields) == 1 {
+		ticks, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid subtitle time: %s", s)
+		}
+		return tickDuration(ticks), nil
+	}
+	if len(fields) == 3 {
+		// HH:MM:SS.sss
+		if i := strings.Index(fields[2], "."); i >= 0 {
+			ms, err := strconv.Atoi((fields[2][i+1:] + "000")[:3])
+			if err != nil {
+				return 0, fmt.Errorf("Invalid subtitle time: %s", s)
+			}
+			fields = []string{fields[0], fields[1], fields[2][:i]}
+			d, err := parseSubtitleTime(strings.Join(append(fields, "0"), ":"), rate)
+			return d + time.Duration(ms)*time.Millisecond, err
+		}
+	}
+	if len(fields) != 4 {
+		return 0, fmt.Errorf("Invalid subtitle time: %s", s)
+	}
+	var v [4]int
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid subtitle time: %s", s)
+		}
+		v[i] = n
+	}
+	return time.Duration(v[0])*time.Hour + time.Duration(v[1])*time.Minute +
+		time.Duration(v[2])*time.Second + tickDuration(v[3]), nil
+}
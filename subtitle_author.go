@@ -0,0 +1,405 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Authoring of Interop and SMPTE subtitle documents from SRT files
+*/
+
+package dcp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smpteSubtitleNamespace is the namespace of SMPTE ST 428-7 documents
+const smpteSubtitleNamespace = "http://www.smpte-ra.org/schemas/428-7/2010/DCST"
+
+// Placement of the lines of SRT subtitles, as percentages of screen height
+const (
+	srtBottomPosition = 10
+	srtLineSpacing    = 8
+)
+
+// defaultFontSize is the font size used when a reel's subtitles set none
+const defaultFontSize = 42
+
+// srtTimeRegExp matches an SRT cue's timing line
+var srtTimeRegExp = regexp.MustCompile(
+	`^(\d+):(\d\d):(\d\d)[,.](\d\d\d)\s*-->\s*(\d+):(\d\d):(\d\d)[,.](\d\d\d)`)
+
+// ParseSRTFile parses an SRT file, whose file path is filename
+func ParseSRTFile(filename string) ([]*Cue, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSRT(data)
+}
+
+/*
+ParseSRT parses SRT subtitles into cues; lines are placed at the bottom of
+the screen and <i>, <b> and <u> tags become font styles
+*/
+func ParseSRT(data []byte) ([]*Cue, error) {
+	str := strings.TrimPrefix(string(data), "\uFEFF")
+	str = strings.Replace(str, "\r\n", "\n", -1)
+	var cues []*Cue
+	for _, block := range regexp.MustCompile(`\n\s*\n`).Split(str, -1) {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		if len(lines) == 1 && lines[0] == "" {
+			continue
+		}
+		// The cue number is optional
+		if !srtTimeRegExp.MatchString(lines[0]) {
+			lines = lines[1:]
+		}
+		if len(lines) == 0 || !srtTimeRegExp.MatchString(lines[0]) {
+			return nil, errors.New("Invalid SRT cue: " + block)
+		}
+		m := srtTimeRegExp.FindStringSubmatch(lines[0])
+		cue := &Cue{Start: srtTime(m[1:5]), End: srtTime(m[5:9])}
+		for i, line := range lines[1:] {
+			cue.Texts = append(cue.Texts, &SubtitleText{
+				Placement: Placement{
+					VAlign:    "bottom",
+					VPosition: float64(srtBottomPosition + (len(lines)-2-i)*srtLineSpacing)},
+				Runs: srtRuns(line)})
+		}
+		cues = append(cues, cue)
+	}
+	return cues, nil
+}
+
+// srtTime converts the hours, minutes, seconds and milliseconds of an SRT
+// time, which have been matched as numbers
+func srtTime(fields []string) time.Duration {
+	var v [4]int
+	for i, f := range fields {
+		v[i], _ = strconv.Atoi(f)
+	}
+	return time.Duration(v[0])*time.Hour + time.Duration(v[1])*time.Minute +
+		time.Duration(v[2])*time.Second + time.Duration(v[3])*time.Millisecond
+}
+
+// srtTagRegExp matches the formatting tags found in SRT text
+var srtTagRegExp = regexp.MustCompile(`(?i)</?(i|b|u|font)(\s[^>]*)?>`)
+
+// srtRuns splits a line of SRT text into runs at its formatting tags
+func srtRuns(line string) []*TextRun {
+	var runs []*TextRun
+	var font FontStyle
+	add := func(text string) {
+		if text != "" {
+			runs = append(runs, &TextRun{text, font})
+		}
+	}
+	last := 0
+	for _, loc := range srtTagRegExp.FindAllStringSubmatchIndex(line, -1) {
+		add(line[last:loc[0]])
+		last = loc[1]
+		on := line[loc[0]+1] != '/'
+		switch strings.ToLower(line[loc[2]:loc[3]]) {
+		case "i":
+			font.Italic = on
+		case "b":
+			font.Bold = on
+		case "u":
+			font.Underline = on
+		}
+	}
+	add(line[last:])
+	return runs
+}
+
+/*
+NewSubtitleReel makes a subtitle document of the given format from cues;
+font is used for all the text, and editRate is the edit rate of the reel
+the subtitles will be attached to
+*/
+func NewSubtitleReel(format Format, cues []*Cue, font *LoadFont,
+	language string, editRate EditRate) (*SubtitleReel, error) {
+	if !editRate.valid() {
+		return nil, errors.New("Invalid edit rate: " + editRate.String())
+	}
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	reel := &SubtitleReel{
+		Format:    format,
+		ID:        id,
+		IssueDate: time.Now().Truncate(time.Second),
+		Language:  language,
+		EditRate:  editRate}
+	switch format {
+	case INTEROP:
+		reel.TimeCodeRate = interopTickRate
+	case SMPTE:
+		reel.TimeCodeRate = int(editRate.timecodeBase())
+	default:
+		return nil, errors.New("Unable to make subtitles of unknown format")
+	}
+	if font != nil {
+		reel.LoadFonts = []*LoadFont{font}
+	}
+	for i, cue := range cues {
+		reel.Spots = append(reel.Spots, &SubtitleSpot{
+			SpotNumber: i + 1,
+			TimeIn:     cue.Start,
+			TimeOut:    cue.End,
+			Texts:      cue.Texts})
+	}
+	return reel, nil
+}
+
+/*
+Asset returns a CPL subtitle asset for the document, playing all of its
+subtitles, which can be added to a reel; the reel's EditRate must be set
+*/
+func (reel *SubtitleReel) Asset() (*Subtitle, error) {
+	if !reel.EditRate.valid() {
+		return nil, errors.New("Invalid edit rate: " + reel.EditRate.String())
+	}
+	var end time.Duration
+	for _, spot := range reel.Spots {
+		if spot.TimeOut > end {
+			end = spot.TimeOut
+		}
+	}
+	// Round up, so that the last subtitle isn't cut short
+	frames := reel.EditRate.Units(end)
+	if reel.EditRate.Duration(frames) < end {
+		frames++
+	}
+	id := reel.ID
+	if !strings.HasPrefix(id, "urn:uuid:") {
+		id = "urn:uuid:" + id
+	}
+	return &Subtitle{
+		Asset: Asset{
+			ID:                id,
+			EditRate:          reel.EditRate,
+			IntrinsicDuration: frames,
+			Duration:          frames},
+		Language: reel.Language}, nil
+}
+
+/*
+MarshalSubtitleReel produces the subtitle document's XML; the document type
+is chosen from the reel's Format, and times are written in the reel's
+TimeCodeRate ticks
+*/
+func MarshalSubtitleReel(reel *SubtitleReel) ([]byte, error) {
+	if reel.TimeCodeRate <= 0 {
+		return nil, errors.New("Invalid TimeCodeRate: " + strconv.Itoa(reel.TimeCodeRate))
+	}
+	w := &subtitleWriter{reel: reel}
+	switch reel.Format {
+	case INTEROP:
+		w.interopHeader()
+	case SMPTE:
+		w.smpteHeader()
+	default:
+		return nil, errors.New("Unable to marshal subtitles of unknown format")
+	}
+	return w.buf.Bytes(), nil
+}
+
+// subtitleWriter writes a subtitle document; text runs are written by hand
+// since xml.Encoder's indentation would add spaces to mixed content
+type subtitleWriter struct {
+	reel *SubtitleReel
+	buf  bytes.Buffer
+}
+
+// interopHeader writes an Interop DCSubtitle document
+func (w *subtitleWriter) interopHeader() {
+	reel := w.reel
+	w.buf.WriteString(xml.Header)
+	w.buf.WriteString("<DCSubtitle Version=\"1.0\">\n")
+	w.element(1, "SubtitleID", strings.TrimPrefix(reel.ID, "urn:uuid:"))
+	w.element(1, "MovieTitle", reel.ContentTitleText)
+	w.element(1, "ReelNumber", strconv.Itoa(reelNumber(reel)))
+	w.element(1, "Language", reel.Language)
+	for _, font := range reel.LoadFonts {
+		fmt.Fprintf(&w.buf, "  <LoadFont Id=%s URI=%s/>\n", quote(font.ID), quote(font.URI))
+	}
+	w.spots(1)
+	w.buf.WriteString("</DCSubtitle>\n")
+}
+
+// smpteHeader writes a SMPTE SubtitleReel document
+func (w *subtitleWriter) smpteHeader() {
+	reel := w.reel
+	w.buf.WriteString(xml.Header)
+	fmt.Fprintf(&w.buf, "<SubtitleReel xmlns=%s>\n", quote(smpteSubtitleNamespace))
+	w.element(1, "Id", reel.ID)
+	w.element(1, "ContentTitleText", reel.ContentTitleText)
+	w.element(1, "IssueDate", reel.IssueDate.Format(time.RFC3339))
+	w.element(1, "ReelNumber", strconv.Itoa(reelNumber(reel)))
+	if reel.Language != "" {
+		w.element(1, "Language", reel.Language)
+	}
+	w.element(1, "EditRate", reel.EditRate.String())
+	w.element(1, "TimeCodeRate", strconv.Itoa(reel.TimeCodeRate))
+	if reel.StartTime > 0 {
+		w.element(1, "StartTime", w.time(0))
+	}
+	for _, font := range reel.LoadFonts {
+		fmt.Fprintf(&w.buf, "  <LoadFont ID=%s>%s</LoadFont>\n", quote(font.ID), escape(font.URI))
+	}
+	w.buf.WriteString("  <SubtitleList>\n")
+	w.spots(2)
+	w.buf.WriteString("  </SubtitleList>\n")
+	w.buf.WriteString("</SubtitleReel>\n")
+}
+
+// spots writes the subtitles, inside a Font element selecting the first
+// loaded font
+func (w *subtitleWriter) spots(depth int) {
+	reel := w.reel
+	indent := strings.Repeat("  ", depth)
+	idAttr := "Id"
+	if reel.Format == SMPTE {
+		idAttr = "ID"
+	}
+	w.buf.WriteString(indent + "<Font")
+	if len(reel.LoadFonts) > 0 {
+		fmt.Fprintf(&w.buf, " %s=%s", idAttr, quote(reel.LoadFonts[0].ID))
+	}
+	fmt.Fprintf(&w.buf, " Size=\"%d\">\n", defaultFontSize)
+	for _, spot := range reel.Spots {
+		fmt.Fprintf(&w.buf, "%s  <Subtitle SpotNumber=\"%d\" TimeIn=\"%s\" TimeOut=\"%s\""+
+			" FadeUpTime=\"%s\" FadeDownTime=\"%s\">\n", indent, spot.SpotNumber,
+			w.time(spot.TimeIn), w.time(spot.TimeOut),
+			w.duration(spot.FadeUpTime), w.duration(spot.FadeDownTime))
+		for _, text := range spot.Texts {
+			w.buf.WriteString(indent + "    <Text" + w.placement(text.Placement) + ">")
+			for _, run := range text.Runs {
+				w.run(run)
+			}
+			w.buf.WriteString("</Text>\n")
+		}
+		for _, image := range spot.Images {
+			w.buf.WriteString(indent + "    <Image" + w.placement(image.Placement) + ">")
+			w.buf.WriteString(escape(image.Ref) + "</Image>\n")
+		}
+		w.buf.WriteString(indent + "  </Subtitle>\n")
+	}
+	w.buf.WriteString(indent + "</Font>\n")
+}
+
+// run writes a run of text, inside a Font element if it is styled
+func (w *subtitleWriter) run(run *TextRun) {
+	var attrs string
+	if run.Font.Italic {
+		attrs += ` Italic="yes"`
+	}
+	if run.Font.Bold {
+		attrs += ` Weight="bold"`
+	}
+	if run.Font.Underline {
+		if w.reel.Format == SMPTE {
+			attrs += ` Underline="yes"`
+		} else {
+			attrs += ` Underlined="yes"`
+		}
+	}
+	if run.Font.Color != "" {
+		attrs += " Color=" + quote(run.Font.Color)
+	}
+	if attrs == "" {
+		w.buf.WriteString(escape(run.Text))
+		return
+	}
+	w.buf.WriteString("<Font" + attrs + ">" + escape(run.Text) + "</Font>")
+}
+
+// placement returns the attributes positioning a text or image, whose names
+// are capitalised differently in SMPTE documents
+func (w *subtitleWriter) placement(p Placement) string {
+	hAlign, hPosition, vAlign, vPosition := "HAlign", "HPosition", "VAlign", "VPosition"
+	if w.reel.Format == SMPTE {
+		hAlign, hPosition, vAlign, vPosition = "Halign", "Hposition", "Valign", "Vposition"
+	}
+	var attrs string
+	if p.HAlign != "" {
+		attrs += " " + hAlign + "=" + quote(p.HAlign)
+	}
+	if p.HPosition != 0 {
+		attrs += " " + hPosition + "=" + quote(strconv.FormatFloat(p.HPosition, 'f', -1, 64))
+	}
+	if p.VAlign != "" {
+		attrs += " " + vAlign + "=" + quote(p.VAlign)
+	}
+	if p.VPosition != 0 {
+		attrs += " " + vPosition + "=" + quote(strconv.FormatFloat(p.VPosition, 'f', -1, 64))
+	}
+	if p.Direction != "" {
+		attrs += " Direction=" + quote(p.Direction)
+	}
+	return attrs
+}
+
+// time formats a time relative to the reel as HH:MM:SS:TT, offset by the
+// reel's StartTime
+func (w *subtitleWriter) time(d time.Duration) string {
+	return w.duration(d + w.reel.StartTime)
+}
+
+// duration formats a duration as HH:MM:SS:TT, in TimeCodeRate ticks
+func (w *subtitleWriter) duration(d time.Duration) string {
+	rate := int64(w.reel.TimeCodeRate)
+	ticks := (int64(d)*rate + int64(time.Second)/2) / int64(time.Second)
+	seconds := ticks / rate
+	format := "%02d:%02d:%02d:%02d"
+	if rate > 100 {
+		format = "%02d:%02d:%02d:%03d"
+	}
+	return fmt.Sprintf(format, seconds/3600, seconds/60%60, seconds%60, ticks%rate)
+}
+
+// element writes a simple element on its own line
+func (w *subtitleWriter) element(depth int, name, text string) {
+	fmt.Fprintf(&w.buf, "%s<%s>%s</%s>\n", strings.Repeat("  ", depth), name, escape(text), name)
+}
+
+// reelNumber is the reel's number, which starts at 1
+func reelNumber(reel *SubtitleReel) int {
+	if reel.ReelNumber < 1 {
+		return 1
+	}
+	return reel.ReelNumber
+}
+
+// escape escapes text for use in XML
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// quote escapes and quotes an attribute value
+func quote(s string) string {
+	return `"` + escape(s) + `"`
+}
@@ -0,0 +1,116 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"testing"
+	"time"
+)
+
+var testSRT = []byte("1\r\n00:00:01,500 --> 00:00:03,000\r\nFirst line\r\n" +
+	"<i>second</i> & last\r\n\r\n2\r\n00:01:00,000 --> 00:01:02,012\r\nAgain\r\n")
+
+func TestParseSRT(t *testing.T) {
+	cues, err := ParseSRT(testSRT)
+	if err != nil {
+		t.Fatalf("Error parsing SRT: %s", err)
+	}
+	if len(cues) != 2 {
+		t.Fatalf("Number of cues is incorrect: %d != 2", len(cues))
+	}
+	if cues[0].Start != 1500*time.Millisecond || cues[0].End != 3*time.Second {
+		t.Errorf("Cue times are incorrect: %s %s", cues[0].Start, cues[0].End)
+	}
+	if len(cues[0].Texts) != 2 {
+		t.Fatalf("Number of lines is incorrect: %d != 2", len(cues[0].Texts))
+	}
+	if cues[0].Texts[0].VPosition <= cues[0].Texts[1].VPosition {
+		t.Errorf("First line is below the second: %f %f",
+			cues[0].Texts[0].VPosition, cues[0].Texts[1].VPosition)
+	}
+	runs := cues[0].Texts[1].Runs
+	if len(runs) != 2 || !runs[0].Font.Italic || runs[1].Font.Italic ||
+		runs[1].Text != " & last" {
+		t.Errorf("Runs are incorrect: %+v %+v", runs[0], runs[1])
+	}
+	if _, err := ParseSRT([]byte("1\nnot a time\ntext\n")); err == nil {
+		t.Error("Invalid SRT parsed")
+	}
+}
+
+func TestMarshalSubtitleReel(t *testing.T) {
+	cues, err := ParseSRT(testSRT)
+	if err != nil {
+		t.Fatalf("Error parsing SRT: %s", err)
+	}
+	for _, format := range []Format{INTEROP, SMPTE} {
+		font := &LoadFont{"font1", "font.ttf"}
+		reel, err := NewSubtitleReel(format, cues, font, "en", EditRate{24, 1})
+		if err != nil {
+			t.Fatalf("Error making subtitles: %s", err)
+		}
+		xmlStr, err := MarshalSubtitleReel(reel)
+		if err != nil {
+			t.Fatalf("Error marshalling subtitles: %s", err)
+		}
+		parsed, err := ParseSubtitleReel(xmlStr)
+		if err != nil {
+			t.Fatalf("Error parsing marshalled subtitles: %s\n%s", err, xmlStr)
+		}
+		if parsed.Format != format || len(parsed.Spots) != 2 {
+			t.Fatalf("Marshalled subtitles are incorrect:\n%s", xmlStr)
+		}
+		// SMPTE times are rounded to the nearest frame
+		spot := parsed.Spots[1]
+		expected := 2012 * time.Millisecond
+		if format == SMPTE {
+			expected = 2 * time.Second
+		}
+		if spot.TimeIn != time.Minute || spot.TimeOut != time.Minute+expected {
+			t.Errorf("Times are incorrect: %s %s", spot.TimeIn, spot.TimeOut)
+		}
+		text := parsed.Spots[0].Texts[1]
+		if text.String() != "second & last" || !text.Runs[0].Font.Italic {
+			t.Errorf("Text is incorrect: %+v", text.Runs)
+		}
+		if text.Runs[0].Font.ID != "font1" || text.VAlign != "bottom" {
+			t.Errorf("Font or placement is incorrect: %+v", text)
+		}
+		if len(parsed.LoadFonts) != 1 || parsed.LoadFonts[0].URI != "font.ttf" {
+			t.Errorf("LoadFonts are incorrect: %+v", parsed.LoadFonts)
+		}
+	}
+}
+
+func TestSubtitleReelAsset(t *testing.T) {
+	cues, err := ParseSRT(testSRT)
+	if err != nil {
+		t.Fatalf("Error parsing SRT: %s", err)
+	}
+	reel, err := NewSubtitleReel(INTEROP, cues, nil, "en", EditRate{24, 1})
+	if err != nil {
+		t.Fatalf("Error making subtitles: %s", err)
+	}
+	subtitle, err := reel.Asset()
+	if err != nil {
+		t.Fatalf("Error making asset: %s", err)
+	}
+	// 62.012s is 1488.288 frames, rounded up
+	if subtitle.ID != reel.ID || subtitle.Duration != 1489 ||
+		subtitle.IntrinsicDuration != 1489 || subtitle.Language != "en" {
+		t.Errorf("Asset is incorrect: %+v", subtitle)
+	}
+}
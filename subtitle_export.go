@@ -0,0 +1,171 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Conversion of DCP subtitles to SRT and WebVTT, with times relative to the
+start of the composition
+*/
+
+package dcp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cue is a subtitle placed on the composition's timeline
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Texts []*SubtitleText // ordered from the top of the screen down
+}
+
+// SubtitleCues reads the subtitles of every reel of a CPL and places them on
+// the composition's timeline, trimmed to each reel's EntryPoint and Duration
+func (dcp *DCP) SubtitleCues(cpl *CPL) ([]*Cue, error) {
+	var cues []*Cue
+	var offset time.Duration
+	for _, reel := range cpl.Reels {
+		if reel.Subtitle != nil {
+			subtitleReel, err := dcp.SubtitleReel(reel.Subtitle)
+			if err != nil {
+				return nil, err
+			}
+			reelCues, err := SubtitleReelCues(subtitleReel, reel.Subtitle, offset)
+			if err != nil {
+				return nil, err
+			}
+			cues = append(cues, reelCues...)
+		}
+		offset += reel.Duration()
+	}
+	return cues, nil
+}
+
+/*
+SubtitleReelCues converts the text subtitles of a subtitle document to cues,
+for the CPL asset subtitle starting at offset in the composition; subtitles
+before the asset's EntryPoint or after its Duration are dropped or trimmed
+*/
+func SubtitleReelCues(reel *SubtitleReel, subtitle *Subtitle,
+	offset time.Duration) ([]*Cue, error) {
+	if !subtitle.EditRate.valid() {
+		return nil, errors.New("Subtitle asset " + subtitle.ID + " has no edit rate")
+	}
+	entryPoint := subtitle.EditRate.Duration(subtitle.EntryPoint)
+	duration := subtitle.EditRate.Duration(subtitle.playedDuration())
+	var cues []*Cue
+	for _, spot := range reel.Spots {
+		if len(spot.Texts) == 0 {
+			continue
+		}
+		start, end := spot.TimeIn-entryPoint, spot.TimeOut-entryPoint
+		if end <= 0 || start >= duration {
+			continue
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end > duration {
+			end = duration
+		}
+		texts := append([]*SubtitleText{}, spot.Texts...)
+		sort.SliceStable(texts, func(i, j int) bool {
+			return texts[i].screenPosition() < texts[j].screenPosition()
+		})
+		cues = append(cues, &Cue{offset + start, offset + end, texts})
+	}
+	return cues, nil
+}
+
+// WriteSRT writes cues as a SubRip document
+func WriteSRT(w io.Writer, cues []*Cue) error {
+	bw := bufio.NewWriter(w)
+	for i, cue := range cues {
+		fmt.Fprintf(bw, "%d\n%s --> %s\n", i+1,
+			formatCueTime(cue.Start, ","), formatCueTime(cue.End, ","))
+		for _, text := range cue.Texts {
+			bw.WriteString(formatCueText(text, false) + "\n")
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// WriteWebVTT writes cues as a WebVTT document
+func WriteWebVTT(w io.Writer, cues []*Cue) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		fmt.Fprintf(bw, "%s --> %s\n",
+			formatCueTime(cue.Start, "."), formatCueTime(cue.End, "."))
+		for _, text := range cue.Texts {
+			bw.WriteString(formatCueText(text, true) + "\n")
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// formatCueTime formats a time as HH:MM:SS followed by sep and milliseconds
+func formatCueTime(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60,
+		ms/1000%60, sep, ms%1000)
+}
+
+// webVTTEscaper escapes the characters WebVTT reserves in cue text
+var webVTTEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// formatCueText writes a line of text, marking up italic, bold and
+// underlined runs with the tags both SRT and WebVTT understand
+func formatCueText(text *SubtitleText, escape bool) string {
+	var s string
+	for _, run := range text.Runs {
+		str := strings.Replace(run.Text, "\n", " ", -1)
+		if escape {
+			str = webVTTEscaper.Replace(str)
+		}
+		if run.Font.Underline {
+			str = "<u>" + str + "</u>"
+		}
+		if run.Font.Bold {
+			str = "<b>" + str + "</b>"
+		}
+		if run.Font.Italic {
+			str = "<i>" + str + "</i>"
+		}
+		s += str
+	}
+	return strings.TrimSpace(s)
+}
+
+// screenPosition is the distance of the text from the top of the screen,
+// as a percentage of the screen height
+func (t SubtitleText) screenPosition() float64 {
+	switch strings.ToLower(t.VAlign) {
+	case "top":
+		return t.VPosition
+	case "center":
+		return 50 + t.VPosition
+	default:
+		return 100 - t.VPosition
+	}
+}
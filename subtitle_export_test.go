@@ -0,0 +1,108 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testSubtitleCPL has two 10 second reels; the second reel's subtitles skip
+// their first 2 seconds
+var testSubtitleCPL = &CPL{Reels: []*Reel{
+	{Picture: &Picture{Asset: Asset{EditRate: EditRate{24, 1}, Duration: 240}}},
+	{Picture: &Picture{Asset: Asset{EditRate: EditRate{24, 1}, Duration: 240}},
+		Subtitle: &Subtitle{Asset: Asset{ID: "urn:uuid:sub", EditRate: EditRate{24, 1},
+			EntryPoint: 48, Duration: 240}}},
+}}
+
+func TestSubtitleCues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcp")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "sub.xml"), testInteropSubtitleXML, 0644)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	dcp := &DCP{RootDir: dir, AssetMap: &AssetMap{Assets: []*AMAsset{
+		{ID: "urn:uuid:sub", Chunks: []*Chunk{{Path: "sub.xml"}}}}}}
+	cues, err := dcp.SubtitleCues(testSubtitleCPL)
+	if err != nil {
+		t.Fatalf("Error reading cues: %s", err)
+	}
+	// The image subtitle is dropped, and the text moves from 5s in the
+	// subtitle file to 10s + 5s - 2s
+	if len(cues) != 1 {
+		t.Fatalf("Number of cues is incorrect: %d != 1", len(cues))
+	}
+	if cues[0].Start != 13*time.Second || cues[0].End != 15500*time.Millisecond {
+		t.Errorf("Cue times are incorrect: %s %s", cues[0].Start, cues[0].End)
+	}
+}
+
+func TestSubtitleReelCuesTrim(t *testing.T) {
+	reel := parseSubtitleReel(t, testInteropSubtitleXML)
+	subtitle := &Subtitle{Asset: Asset{EditRate: EditRate{24, 1}, EntryPoint: 144, Duration: 24}}
+	cues, err := SubtitleReelCues(reel, subtitle, time.Minute)
+	if err != nil {
+		t.Fatalf("Error reading cues: %s", err)
+	}
+	if len(cues) != 1 {
+		t.Fatalf("Number of cues is incorrect: %d != 1", len(cues))
+	}
+	if cues[0].Start != time.Minute || cues[0].End != time.Minute+time.Second {
+		t.Errorf("Cue times are incorrect: %s %s", cues[0].Start, cues[0].End)
+	}
+}
+
+// testCues has a cue of two lines, the second in italics
+var testCues = []*Cue{{
+	Start: 3723*time.Second + 45*time.Millisecond,
+	End:   3725 * time.Second,
+	Texts: []*SubtitleText{
+		{Placement{VAlign: "bottom", VPosition: 20},
+			[]*TextRun{{Text: "First "}, {Text: "line", Font: FontStyle{Bold: true}}}},
+		{Placement{VAlign: "bottom", VPosition: 10},
+			[]*TextRun{{Text: "a < b", Font: FontStyle{Italic: true}}}},
+	}}}
+
+func TestWriteSRT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSRT(&buf, testCues); err != nil {
+		t.Fatalf("%s", err)
+	}
+	expected := "1\n01:02:03,045 --> 01:02:05,000\nFirst <b>line</b>\n<i>a < b</i>\n\n"
+	if buf.String() != expected {
+		t.Errorf("SRT is incorrect: %q != %q", buf.String(), expected)
+	}
+}
+
+func TestWriteWebVTT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteWebVTT(&buf, testCues); err != nil {
+		t.Fatalf("%s", err)
+	}
+	expected := "WEBVTT\n\n01:02:03.045 --> 01:02:05.000\nFirst <b>line</b>\n<i>a &lt; b</i>\n\n"
+	if buf.String() != expected {
+		t.Errorf("WebVTT is incorrect: %q != %q", buf.String(), expected)
+	}
+}
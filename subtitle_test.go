@@ -0,0 +1,186 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"testing"
+	"time"
+)
+
+var testInteropSubtitleXML = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<DCSubtitle Version="1.0">
+  <SubtitleID>5a2d3b38-9ad9-4a93-a1c5-3c8f6a0a2c91</SubtitleID>
+  <MovieTitle>Test Film</MovieTitle>
+  <ReelNumber>1</ReelNumber>
+  <Language>English</Language>
+  <LoadFont Id="theFont" URI="font.ttf"/>
+  <Font Id="theFont" Size="42" Color="FFFFFFFF" Effect="border" EffectColor="FF000000">
+    <Subtitle SpotNumber="1" TimeIn="00:00:05:000" TimeOut="00:00:07:125" FadeUpTime="20" FadeDownTime="20">
+      <Text VAlign="bottom" VPosition="15">Hello <Font Italic="yes">there</Font></Text>
+    </Subtitle>
+    <Subtitle SpotNumber="2" TimeIn="00:01:00:050" TimeOut="00:01:02:000">
+      <Image HAlign="center" VAlign="bottom" VPosition="10">subtitle_2.png</Image>
+    </Subtitle>
+  </Font>
+</DCSubtitle>
+`)
+
+var testSMPTESubtitleXML = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<SubtitleReel xmlns="http://www.smpte-ra.org/schemas/428-7/2010/DCST">
+  <Id>urn:uuid:0b4cd9f5-9b49-4f2f-8b5b-2e5c1ea3e1c0</Id>
+  <ContentTitleText>Test Film</ContentTitleText>
+  <ReelNumber>2</ReelNumber>
+  <Language>fr</Language>
+  <EditRate>24 1</EditRate>
+  <TimeCodeRate>24</TimeCodeRate>
+  <StartTime>01:00:00:00</StartTime>
+  <LoadFont ID="font1">urn:uuid:3dec6dc0-39d0-498d-97d0-928d2eb78391</LoadFont>
+  <SubtitleList>
+    <Font ID="font1" Size="40" Weight="bold">
+      <Subtitle SpotNumber="1" TimeIn="01:00:10:12" TimeOut="01:00:12:00" FadeUpTime="00:00:00:02" FadeDownTime="00:00:00:02">
+        <Text Valign="bottom" Vposition="20">Bonjour</Text>
+        <Text Valign="bottom" Vposition="12"><Font Color="FFFFFF00">le monde</Font></Text>
+      </Subtitle>
+    </Font>
+  </SubtitleList>
+</SubtitleReel>
+`)
+
+func parseSubtitleReel(t *testing.T, xmlStr []byte) *SubtitleReel {
+	reel, err := ParseSubtitleReel(xmlStr)
+	if err != nil {
+		t.Fatalf("Error parsing subtitles: %s", err)
+	}
+	return reel
+}
+
+func TestParseInteropSubtitleReel(t *testing.T) {
+	reel := parseSubtitleReel(t, testInteropSubtitleXML)
+	if reel.Format != INTEROP {
+		t.Errorf("Format is incorrect: %d != %d", reel.Format, INTEROP)
+	}
+	if reel.ID != "5a2d3b38-9ad9-4a93-a1c5-3c8f6a0a2c91" {
+		t.Errorf("ID is incorrect: %s", reel.ID)
+	}
+	if reel.ContentTitleText != "Test Film" || reel.ReelNumber != 1 ||
+		reel.Language != "English" {
+		t.Errorf("Header is incorrect: %+v", reel)
+	}
+	if len(reel.LoadFonts) != 1 || reel.LoadFonts[0].ID != "theFont" ||
+		reel.LoadFonts[0].URI != "font.ttf" {
+		t.Fatalf("LoadFonts are incorrect: %+v", reel.LoadFonts)
+	}
+	if len(reel.Spots) != 2 {
+		t.Fatalf("Number of subtitles is incorrect: %d != 2", len(reel.Spots))
+	}
+	spot := reel.Spots[0]
+	if spot.TimeIn != 5*time.Second || spot.TimeOut != 7500*time.Millisecond {
+		t.Errorf("Times are incorrect: %s %s", spot.TimeIn, spot.TimeOut)
+	}
+	if spot.FadeUpTime != 80*time.Millisecond {
+		t.Errorf("FadeUpTime is incorrect: %s != 80ms", spot.FadeUpTime)
+	}
+	if len(spot.Texts) != 1 {
+		t.Fatalf("Number of texts is incorrect: %d != 1", len(spot.Texts))
+	}
+	text := spot.Texts[0]
+	if text.String() != "Hello there" {
+		t.Errorf("Text is incorrect: %s != Hello there", text)
+	}
+	if text.VAlign != "bottom" || text.VPosition != 15 {
+		t.Errorf("Placement is incorrect: %+v", text.Placement)
+	}
+	if len(text.Runs) != 2 {
+		t.Fatalf("Number of runs is incorrect: %d != 2", len(text.Runs))
+	}
+	if text.Runs[0].Font.Italic || !text.Runs[1].Font.Italic {
+		t.Errorf("Italic is incorrect: %+v", text.Runs)
+	}
+	font := text.Runs[1].Font
+	if font.ID != "theFont" || font.Size != 42 || font.Effect != "border" {
+		t.Errorf("Inherited font is incorrect: %+v", font)
+	}
+	spot = reel.Spots[1]
+	if spot.TimeIn != 60200*time.Millisecond {
+		t.Errorf("TimeIn is incorrect: %s != 1m0.2s", spot.TimeIn)
+	}
+	if len(spot.Images) != 1 || spot.Images[0].Ref != "subtitle_2.png" ||
+		spot.Images[0].HAlign != "center" {
+		t.Errorf("Images are incorrect: %+v", spot.Images)
+	}
+}
+
+func TestParseSMPTESubtitleReel(t *testing.T) {
+	reel := parseSubtitleReel(t, testSMPTESubtitleXML)
+	if reel.Format != SMPTE {
+		t.Errorf("Format is incorrect: %d != %d", reel.Format, SMPTE)
+	}
+	if reel.EditRate != (EditRate{24, 1}) || reel.TimeCodeRate != 24 ||
+		reel.StartTime != time.Hour {
+		t.Errorf("Timing is incorrect: %+v", reel)
+	}
+	if len(reel.LoadFonts) != 1 ||
+		reel.LoadFonts[0].URI != "urn:uuid:3dec6dc0-39d0-498d-97d0-928d2eb78391" {
+		t.Fatalf("LoadFonts are incorrect: %+v", reel.LoadFonts)
+	}
+	if len(reel.Spots) != 1 {
+		t.Fatalf("Number of subtitles is incorrect: %d != 1", len(reel.Spots))
+	}
+	spot := reel.Spots[0]
+	if spot.TimeIn != 10500*time.Millisecond || spot.TimeOut != 12*time.Second {
+		t.Errorf("Times are incorrect: %s %s", spot.TimeIn, spot.TimeOut)
+	}
+	if len(spot.Texts) != 2 || spot.Texts[1].String() != "le monde" {
+		t.Fatalf("Texts are incorrect: %+v", spot.Texts)
+	}
+	if spot.Texts[0].VPosition != 20 {
+		t.Errorf("VPosition is incorrect: %f != 20", spot.Texts[0].VPosition)
+	}
+	font := spot.Texts[1].Runs[0].Font
+	if !font.Bold || font.Size != 40 || font.Color != "FFFFFF00" {
+		t.Errorf("Font is incorrect: %+v", font)
+	}
+}
+
+func TestParseSubtitleTime(t *testing.T) {
+	tests := []struct {
+		s    string
+		rate int
+		d    time.Duration
+	}{
+		{"00:00:01:125", 250, 1500 * time.Millisecond},
+		{"01:02:03:12", 24, time.Hour + 2*time.Minute + 3500*time.Millisecond},
+		{"00:00:01.250", 250, 1250 * time.Millisecond},
+		{"50", 250, 200 * time.Millisecond},
+	}
+	for _, test := range tests {
+		d, err := parseSubtitleTime(test.s, test.rate)
+		if err != nil {
+			t.Errorf("Error parsing %s: %s", test.s, err)
+		} else if d != test.d {
+			t.Errorf("Time is incorrect: %s != %s", d, test.d)
+		}
+	}
+	if _, err := parseSubtitleTime("1:2", 24); err == nil {
+		t.Error("Invalid time parsed")
+	}
+}
+
+func TestParseSubtitleReelUnknown(t *testing.T) {
+	if _, err := ParseSubtitleReel(testCPLXML); err == nil {
+		t.Error("CPL parsed as subtitles")
+	}
+}
@@ -0,0 +1,349 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Reading DCPs from tar archives in a single pass, as they're streamed from
+tape, without extracting them
+*/
+
+package dcp
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/googlesamples/dcp/mxf"
+)
+
+// CodeArchiveInvalid is reported when a tar archive can't be read
+const CodeArchiveInvalid Code = "ARCHIVE_INVALID"
+
+/*
+maxTarBuffered is the size up to which files are kept in memory while a tar
+archive is read; only the start of larger files, such as MXFs, is kept, for
+identifying them, along with the header metadata of those that are MXFs
+*/
+var maxTarBuffered int64 = 16 << 20
+
+// tarHeaderSize is how much of a file that isn't buffered is kept
+const tarHeaderSize = 512
+
+// gzipMagic are the first bytes of a gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+/*
+OpenTar reads a DCP from a tar archive, which may be gzip compressed, in a
+single pass; the DCP is the directory of the archive holding the shallowest
+assetmap. Every file is hashed as it's read, so that sizes and hashes are
+verified without extracting the archive. It returns the first error found,
+use ValidateTar to find all of them
+*/
+func OpenTar(r io.Reader) (*DCP, error) {
+	dcp := &DCP{}
+	if err := dcp.ValidateTar(r).Err(); err != nil {
+		return nil, err
+	}
+	return dcp, nil
+}
+
+// ValidateTar is Validate for a DCP in a tar archive, as read by OpenTar;
+// the hash of every asset is checked too
+func (dcp *DCP) ValidateTar(r io.Reader) *Report {
+	tfs, err := readTar(r)
+	if err != nil {
+		report := &Report{}
+		report.Add(SeverityError, CodeArchiveInvalid, "", "", err.Error())
+		return report
+	}
+	root := tfs.dcpRoot()
+	sub, err := fs.Sub(tfs, root)
+	if err != nil {
+		report := &Report{}
+		report.Add(SeverityError, CodeArchiveInvalid, root, "", err.Error())
+		return report
+	}
+	dcp.hashes = tfs.hashes(root)
+	report := dcp.validate([]fs.FS{sub}, []string{root})
+	if dcp.AssetMap != nil {
+		CheckHashes(dcp, report)
+	}
+	return report
+}
+
+// tarFile is a regular file read from a tar archive
+type tarFile struct {
+	path     string // cleaned path within the archive
+	size     int64
+	modTime  time.Time
+	hash     string // Base64 SHA-1 of the whole file
+	data     []byte // the whole file if buffered, otherwise its start
+	buffered bool
+
+	header    *mxf.File // MXF header metadata of a file that wasn't buffered
+	headerErr error     // why header couldn't be parsed
+}
+
+// tarFile is its own fs.FileInfo
+func (f *tarFile) Name() string       { return path.Base(f.path) }
+func (f *tarFile) Size() int64        { return f.size }
+func (f *tarFile) Mode() fs.FileMode  { return 0444 }
+func (f *tarFile) ModTime() time.Time { return f.modTime }
+func (f *tarFile) IsDir() bool        { return false }
+func (f *tarFile) Sys() interface{}   { return nil }
+
+// tarDirInfo is the fs.FileInfo of a directory in a tar archive
+type tarDirInfo struct {
+	name string
+}
+
+func (d tarDirInfo) Name() string       { return d.name }
+func (d tarDirInfo) Size() int64        { return 0 }
+func (d tarDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (d tarDirInfo) ModTime() time.Time { return time.Time{} }
+func (d tarDirInfo) IsDir() bool        { return true }
+func (d tarDirInfo) Sys() interface{}   { return nil }
+
+// tarFS is a file system of the files read from a tar archive; files that
+// weren't buffered can only be read up to their first tarHeaderSize bytes,
+// but the header metadata of MXFs is still available to parseMXF
+type tarFS struct {
+	files map[string]*tarFile
+	dirs  map[string][]fs.DirEntry // sorted entries of each directory
+}
+
+// readTar reads every regular file from a tar archive, hashing all of them
+// and buffering those up to maxTarBuffered bytes; larger files are parsed
+// as MXFs as they go by
+func readTar(r io.Reader) (*tarFS, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		src = gz
+	}
+	tfs := &tarFS{files: map[string]*tarFile{}, dirs: map[string][]fs.DirEntry{".": nil}}
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := fsName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			tfs.addDir(name)
+		case tar.TypeReg:
+			file := &tarFile{path: name, size: hdr.Size, modTime: hdr.ModTime}
+			keep := int64(tarHeaderSize)
+			if hdr.Size <= maxTarBuffered {
+				keep, file.buffered = hdr.Size, true
+			}
+			h := sha1.New()
+			head := &headWriter{max: int(keep)}
+			src := io.TeeReader(tr, io.MultiWriter(h, head))
+			if !file.buffered {
+				file.header, file.headerErr = mxf.ParseHeader(src)
+			}
+			if _, err := io.Copy(ioutil.Discard, src); err != nil {
+				return nil, err
+			}
+			file.hash = base64.StdEncoding.EncodeToString(h.Sum(nil))
+			file.data = head.buf
+			tfs.addFile(file)
+		}
+	}
+	for _, entries := range tfs.dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+	return tfs, nil
+}
+
+// headWriter keeps the first max bytes written to it
+type headWriter struct {
+	buf []byte
+	max int
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if n := w.max - len(w.buf); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+	}
+	return len(p), nil
+}
+
+// addFile adds a file, and the directories above it
+func (tfs *tarFS) addFile(file *tarFile) {
+	if _, ok := tfs.files[file.path]; !ok {
+		dir := path.Dir(file.path)
+		tfs.addDir(dir)
+		tfs.dirs[dir] = append(tfs.dirs[dir], fs.FileInfoToDirEntry(file))
+	}
+	tfs.files[file.path] = file
+}
+
+// addDir adds a directory, and the directories above it
+func (tfs *tarFS) addDir(dir string) {
+	if _, ok := tfs.dirs[dir]; ok {
+		return
+	}
+	tfs.dirs[dir] = nil
+	parent := path.Dir(dir)
+	tfs.addDir(parent)
+	tfs.dirs[parent] = append(tfs.dirs[parent],
+		fs.FileInfoToDirEntry(tarDirInfo{path.Base(dir)}))
+}
+
+// dcpRoot returns the directory holding the shallowest assetmap, or the
+// archive's root if there isn't one
+func (tfs *tarFS) dcpRoot() string {
+	root, rootDepth := ".", -1
+	for name := range tfs.files {
+		if !assetMapRegExp.MatchString(path.Base(name)) {
+			continue
+		}
+		dir, depth := path.Dir(name), strings.Count(name, "/")
+		if rootDepth == -1 || depth < rootDepth || (depth == rootDepth && dir < root) {
+			root, rootDepth = dir, depth
+		}
+	}
+	return root
+}
+
+// hashes returns the hashes of the files under root, by their name
+// relative to root
+func (tfs *tarFS) hashes(root string) map[string]string {
+	hashes := map[string]string{}
+	for name, file := range tfs.files {
+		if root == "." {
+			hashes[name] = file.hash
+		} else if strings.HasPrefix(name, root+"/") {
+			hashes[strings.TrimPrefix(name, root+"/")] = file.hash
+		}
+	}
+	return hashes
+}
+
+// Open opens a file or directory of the archive
+func (tfs *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if file, ok := tfs.files[name]; ok {
+		return &openTarFile{file, bytes.NewReader(file.data)}, nil
+	}
+	if entries, ok := tfs.dirs[name]; ok {
+		return &openTarDir{tarDirInfo{path.Base(name)}, entries}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir lists a directory of the archive
+func (tfs *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := tfs.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry{}, entries...), nil
+}
+
+// Stat describes a file or directory of the archive
+func (tfs *tarFS) Stat(name string) (fs.FileInfo, error) {
+	if file, ok := tfs.files[name]; ok {
+		return file, nil
+	}
+	if _, ok := tfs.dirs[name]; ok {
+		return tarDirInfo{path.Base(name)}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// openTarFile is an open file of a tar archive
+type openTarFile struct {
+	*tarFile
+	r *bytes.Reader
+}
+
+func (f *openTarFile) Stat() (fs.FileInfo, error) { return f.tarFile, nil }
+func (f *openTarFile) Close() error               { return nil }
+
+// Read reads the file, failing at the end of the kept data if the file
+// wasn't buffered
+func (f *openTarFile) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF && !f.buffered {
+		return n, errors.New("Only the start of " + f.path + " was kept from the archive")
+	}
+	return n, err
+}
+
+// parseMXF returns the MXF header metadata of the file; it was parsed as
+// the archive was read unless the whole file was buffered
+func (f *openTarFile) parseMXF() (*mxf.File, error) {
+	if f.buffered {
+		return mxf.Parse(bytes.NewReader(f.data))
+	}
+	return f.header, f.headerErr
+}
+
+// openTarDir is an open directory of a tar archive
+type openTarDir struct {
+	info    tarDirInfo
+	entries []fs.DirEntry
+}
+
+func (d *openTarDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *openTarDir) Close() error               { return nil }
+
+func (d *openTarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries, or all remaining ones if n <= 0
+func (d *openTarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 || n > len(d.entries) {
+		if n > 0 && len(d.entries) == 0 {
+			return nil, io.EOF
+		}
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,139 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base64"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// makeTestTar writes files to a tar archive under dir
+func makeTestTar(t *testing.T, files map[string][]byte, dir string, compress bool) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	var tw *tar.Writer
+	if compress {
+		tw = tar.NewWriter(gz)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	// Put the assetmap last, as it could be in an archive
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, name := range names {
+		hdr := &tar.Header{Name: dir + "/" + name, Mode: 0644, Size: int64(len(files[name]))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("%s", err)
+		}
+		tw.Write(files[name])
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if compress {
+		gz.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestValidateTar(t *testing.T) {
+	defer func(max int64) { maxTarBuffered = max }(maxTarBuffered)
+	// Only buffer the XML files, so that the picture is hashed as it's read
+	maxTarBuffered = 2048
+	files := testDCPFiles()
+	files["video.mxf"] = append(files["video.mxf"], make([]byte, 4096)...)
+	for _, compress := range []bool{false, true} {
+		dcp := &DCP{}
+		report := dcp.ValidateTar(bytes.NewReader(makeTestTar(t, files, "archive/DCP", compress)))
+		if dcp.RootDir != "archive/DCP" || len(dcp.CPLs) != 1 || len(dcp.PKLs) != 1 {
+			t.Fatalf("DCP is incorrect: %s %d %d", dcp.RootDir, len(dcp.CPLs), len(dcp.PKLs))
+		}
+		counts := map[Code]int{}
+		for _, f := range report.Findings {
+			counts[f.Code]++
+		}
+		if counts[CodeAssetSize] != 1 || counts[CodeAssetMissing] != 1 {
+			t.Errorf("Size findings are incorrect: %v", report.Findings)
+		}
+		// The fixtures' PKL hashes don't match their files
+		if counts[CodeAssetHash] != 3 {
+			t.Errorf("Hash findings are incorrect: %v", report.Findings)
+		}
+		sum := sha1.Sum(files["video.mxf"])
+		for _, result := range dcp.VerifyHashes() {
+			if result.Path == "video.mxf" &&
+				result.Actual != base64.StdEncoding.EncodeToString(sum[:]) {
+				t.Errorf("Picture hash is incorrect: %s %v", result.Actual, result.Err)
+			}
+		}
+	}
+}
+
+func TestOpenTarInvalid(t *testing.T) {
+	if _, err := OpenTar(bytes.NewReader([]byte("not a tar archive"))); err == nil {
+		t.Error("Invalid archive opened")
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	tfs, err := readTar(bytes.NewReader(makeTestTar(t, testDCPFiles(), "archive/DCP", false)))
+	if err != nil {
+		t.Fatalf("Error reading tar: %s", err)
+	}
+	if err := fstest.TestFS(tfs, "archive/DCP/ASSETMAP", "archive/DCP/video.mxf"); err != nil {
+		t.Error(err)
+	}
+	if root := tfs.dcpRoot(); root != "archive/DCP" {
+		t.Errorf("DCP root is incorrect: %s != archive/DCP", root)
+	}
+}
+
+func TestTarEssences(t *testing.T) {
+	defer func(max int64) { maxTarBuffered = max }(maxTarBuffered)
+	files := testDCPFiles()
+	files["video.mxf"] = testPictureEssence(4096)
+	// Whether the picture is buffered or only its header metadata is kept
+	for _, max := range []int64{2048, 16 << 20} {
+		maxTarBuffered = max
+		dcp := &DCP{}
+		dcp.ValidateTar(bytes.NewReader(makeTestTar(t, files, "DCP", false)))
+		essences := dcp.Essences()
+		if len(essences) != 2 || essences[0].Err != nil || essences[0].Picture == nil {
+			t.Fatalf("Picture essence is incorrect with %d buffered: %v", max, essences)
+		}
+		expected := "4K scope 24 fps (4096x1716)"
+		if essences[0].String() != expected {
+			t.Errorf("Picture summary is incorrect: %s != %s", essences[0].String(), expected)
+		}
+		sum := sha1.Sum(files["video.mxf"])
+		for _, result := range dcp.VerifyHashes() {
+			if result.Path == "video.mxf" &&
+				result.Actual != base64.StdEncoding.EncodeToString(sum[:]) {
+				t.Errorf("Picture hash is incorrect: %s %v", result.Actual, result.Err)
+			}
+		}
+	}
+}
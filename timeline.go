@@ -0,0 +1,100 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Timing of a composition: where each reel starts and how long it and the
+whole composition run
+*/
+
+package dcp
+
+import (
+	"time"
+)
+
+// playedDuration is the number of edit units of the asset that are played
+func (asset Asset) playedDuration() uint64 {
+	if asset.Duration > 0 {
+		return asset.Duration
+	}
+	if asset.IntrinsicDuration > asset.EntryPoint {
+		return asset.IntrinsicDuration - asset.EntryPoint
+	}
+	return 0
+}
+
+// EditRate is the edit rate of the reel's first asset, normally its picture,
+// which the reel's timing is measured in
+func (reel Reel) EditRate() EditRate {
+	assets := reel.Assets()
+	if len(assets) == 0 {
+		return EditRate{}
+	}
+	return assets[0].EditRate
+}
+
+// Units is the running time of the reel, in edit units of its EditRate
+func (reel Reel) Units() uint64 {
+	assets := reel.Assets()
+	if len(assets) == 0 {
+		return 0
+	}
+	return assets[0].playedDuration()
+}
+
+// Duration is the running time of the reel
+func (reel Reel) Duration() time.Duration {
+	return reel.EditRate().Duration(reel.Units())
+}
+
+// EditRate is the edit rate of the CPL's first reel, which the composition's
+// timing is measured in
+func (cpl CPL) EditRate() EditRate {
+	for _, reel := range cpl.Reels {
+		if rate := reel.EditRate(); !rate.IsZero() {
+			return rate
+		}
+	}
+	return EditRate{}
+}
+
+// ReelStarts returns the edit unit each reel starts at on the composition's
+// timeline, in the CPL's EditRate; reels at other rates are rescaled to it
+func (cpl CPL) ReelStarts() []uint64 {
+	rate := cpl.EditRate()
+	starts := make([]uint64, len(cpl.Reels))
+	var start uint64
+	for i, reel := range cpl.Reels {
+		starts[i] = start
+		start += rate.Rescale(reel.Units(), reel.EditRate())
+	}
+	return starts
+}
+
+// Units is the running time of the composition, in edit units of the CPL's
+// EditRate
+func (cpl CPL) Units() uint64 {
+	rate := cpl.EditRate()
+	var units uint64
+	for _, reel := range cpl.Reels {
+		units += rate.Rescale(reel.Units(), reel.EditRate())
+	}
+	return units
+}
+
+// Duration is the running time of the composition
+func (cpl CPL) Duration() time.Duration {
+	return cpl.EditRate().Duration(cpl.Units())
+}
@@ -0,0 +1,54 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCPLTimeline(t *testing.T) {
+	cpl := &CPL{Reels: []*Reel{
+		{Picture: &Picture{Asset: Asset{EditRate: EditRate{24, 1}, IntrinsicDuration: 300,
+			EntryPoint: 60}}},
+		{Picture: &Picture{Asset: Asset{EditRate: EditRate{24, 1}, Duration: 480}}},
+		// A reel at twice the rate is rescaled to the composition's
+		{Picture: &Picture{Asset: Asset{EditRate: EditRate{48, 1}, Duration: 96}}},
+	}}
+	starts := cpl.ReelStarts()
+	if len(starts) != 3 || starts[0] != 0 || starts[1] != 240 || starts[2] != 720 {
+		t.Errorf("Reel starts are incorrect: %v", starts)
+	}
+	if cpl.Units() != 768 || cpl.Duration() != 32*time.Second {
+		t.Errorf("Composition duration is incorrect: %d %s", cpl.Units(), cpl.Duration())
+	}
+	if d := cpl.Reels[2].Duration(); d != 2*time.Second {
+		t.Errorf("Reel duration is incorrect: %s != 2s", d)
+	}
+	if (&CPL{}).Duration() != 0 {
+		t.Errorf("Empty composition should have no duration")
+	}
+}
+
+func TestParsedCPLTimeline(t *testing.T) {
+	cpl := parseCPL(t)
+	if cpl.EditRate() != (EditRate{24, 1}) || cpl.Reels[0].Picture.FrameRate != (EditRate{24, 1}) {
+		t.Errorf("Edit rates are incorrect: %s %s", cpl.EditRate(), cpl.Reels[0].Picture.FrameRate)
+	}
+	if tc := cpl.EditRate().Timecode(cpl.Units()); tc != "00:16:15:00" {
+		t.Errorf("Composition duration is incorrect: %s != 00:16:15:00", tc)
+	}
+}
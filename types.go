@@ -25,6 +25,17 @@ const (
 	SMPTE
 )
 
+// String returns the name of the format
+func (f Format) String() string {
+	switch f {
+	case INTEROP:
+		return "Interop"
+	case SMPTE:
+		return "SMPTE"
+	}
+	return "Unknown"
+}
+
 // AssetType of the different file components of a DCP
 type AssetType int
 
@@ -38,6 +49,23 @@ const (
 	MXFSoundAssetType
 )
 
+// String returns the name of the asset type
+func (t AssetType) String() string {
+	switch t {
+	case CPLAssetType:
+		return "CPL"
+	case PKLAssetType:
+		return "PKL"
+	case MXFAssetType:
+		return "MXF"
+	case MXFPictureAssetType:
+		return "Picture"
+	case MXFSoundAssetType:
+		return "Sound"
+	}
+	return "Unknown"
+}
+
 // IsMxf checks if an asset is an MXF file
 func IsMxf(assetType AssetType) bool {
 	return assetType >= MXFAssetType && assetType <= MXFSoundAssetType
@@ -0,0 +1,265 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Validation of a DCP, collecting every problem found into a report
+*/
+
+package dcp
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Severity of a validation finding
+type Severity int
+
+// Severity levels, in increasing order of importance
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+// String returns the name of the severity level
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Code is a stable identifier for the kind of problem a finding describes
+type Code string
+
+// Finding codes
+const (
+	CodeAssetMapNotFound Code = "ASSETMAP_NOT_FOUND"
+	CodeAssetMapInvalid  Code = "ASSETMAP_INVALID"
+	CodeAssetMissing     Code = "ASSET_MISSING"
+	CodeAssetSize        Code = "ASSET_SIZE_MISMATCH"
+	CodeAssetTypeUnknown Code = "ASSET_TYPE_UNKNOWN"
+	CodeAssetType        Code = "ASSET_TYPE_MISMATCH"
+	CodeCPLInvalid       Code = "CPL_INVALID"
+	CodePKLInvalid       Code = "PKL_INVALID"
+)
+
+// Finding is a single problem found while validating a DCP
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Code     Code     `json:"code"`
+	File     string   `json:"file,omitempty"`    // offending file, relative to the DCP root where possible
+	AssetID  string   `json:"assetId,omitempty"` // UUID of the offending asset, if known
+	Message  string   `json:"message"`
+}
+
+// Error allows a finding to be returned as an error
+func (f *Finding) Error() string {
+	if f.File == "" {
+		return f.Message
+	}
+	return f.File + ": " + f.Message
+}
+
+// Report holds all the findings from validating a DCP
+type Report struct {
+	Findings []*Finding `json:"findings"`
+}
+
+// Add appends a finding to the report
+func (r *Report) Add(severity Severity, code Code, file, assetID, message string) {
+	r.Findings = append(r.Findings, &Finding{severity, code, file, assetID, message})
+}
+
+// Filter returns the findings of the given severity
+func (r *Report) Filter(severity Severity) []*Finding {
+	var findings []*Finding
+	for _, f := range r.Findings {
+		if f.Severity == severity {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// MaxSeverity returns the highest severity in the report, or SeverityInfo
+// if the report is empty
+func (r *Report) MaxSeverity() Severity {
+	max := SeverityInfo
+	for _, f := range r.Findings {
+		if f.Severity > max {
+			max = f.Severity
+		}
+	}
+	return max
+}
+
+// Err returns the first error-level finding, or nil if there are none
+func (r *Report) Err() error {
+	if errs := r.Filter(SeverityError); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Validate builds a DCP from a root directory path containing an assetmap,
+// like Generate, but carries on past problems and reports all of them
+func (dcp *DCP) Validate(dir string) *Report {
+	return dcp.validate([]fs.FS{os.DirFS(dir)}, []string{dir})
+}
+
+// validate loads the DCP from the roots of its volumes and runs the dcpRules
+// against it
+func (dcp *DCP) validate(volumes []fs.FS, rootDirs []string) *Report {
+	report := &Report{}
+	dcp.load(volumes, rootDirs, report)
+	if dcp.AssetMap != nil {
+		for _, rule := range dcpRules {
+			rule(dcp, report)
+		}
+	}
+	return report
+}
+
+// dcpRule checks a loaded DCP as a whole
+type dcpRule func(dcp *DCP, report *Report)
+
+// dcpRules are run once the asset map, CPLs and PKLs have been loaded
+var dcpRules = []dcpRule{
+	checkCrossReferences,
+	checkSignatures,
+	checkCPLs,
+}
+
+// chunkRule checks a single chunk listed in the asset map; name is the
+// chunk's file in fsys and contentType the type identified from the start
+// of the file, which is only read once for all the rules
+type chunkRule func(report *Report, asset *AMAsset, chunk *Chunk, fsys fs.FS, name string,
+	contentType AssetType)
+
+// chunkRules are run against every chunk in the asset map
+var chunkRules = []chunkRule{
+	checkChunkSize,
+	checkChunkType,
+}
+
+// checkChunkSize checks the chunk's file exists and is the correct size
+func checkChunkSize(report *Report, asset *AMAsset, chunk *Chunk, fsys fs.FS, name string,
+	contentType AssetType) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		report.Add(SeverityError, CodeAssetMissing, chunk.Path, asset.ID, err.Error())
+		return
+	}
+	if uint64(info.Size()) != chunk.Size {
+		report.Add(SeverityError, CodeAssetSize, chunk.Path, asset.ID,
+			fmt.Sprintf("File size is incorrect: %d != %d", info.Size(), chunk.Size))
+	}
+}
+
+// checkChunkType checks the chunk's content can be identified and that it
+// agrees with the type guessed from the asset map; only the first chunk of an
+// asset split across volumes starts with a header
+func checkChunkType(report *Report, asset *AMAsset, chunk *Chunk, fsys fs.FS, name string,
+	contentType AssetType) {
+	if chunk.Offset != 0 {
+		return
+	}
+	if _, err := fs.Stat(fsys, name); err != nil {
+		// Already reported by checkChunkSize
+		return
+	}
+	switch aType := contentType; {
+	case aType == UnknownAssetType:
+		report.Add(SeverityInfo, CodeAssetTypeUnknown, chunk.Path, asset.ID,
+			"Asset type could not be determined from its content")
+	case asset.Type == UnknownAssetType:
+	case IsMxf(asset.Type) && IsMxf(aType):
+	case asset.Type != aType:
+		report.Add(SeverityWarning, CodeAssetType, chunk.Path, asset.ID,
+			fmt.Sprintf("Asset type from content does not match the assetmap: %s != %s",
+				aType, asset.Type))
+	}
+}
+
+/*
+load reads the assetmaps and VOLINDEXes of the volumes, then the CPLs and
+PKLs they list, into the DCP, adding any problems found to the report;
+rootDirs are the locations of the volumes, used for RootDir and messages
+*/
+func (dcp *DCP) load(volumes []fs.FS, rootDirs []string, report *Report) {
+	for i, fsys := range volumes {
+		dcp.loadVolume(fsys, rootDirs[i], i+1, report)
+	}
+	if dcp.AssetMap == nil {
+		return
+	}
+	for _, asset := range dcp.AssetMap.Assets {
+		for _, chunk := range asset.Chunks {
+			fsys := dcp.volume(chunk.Volume())
+			if fsys == nil {
+				if chunk.Volume() > int(dcp.AssetMap.VolumeCount) {
+					report.Add(SeverityError, CodeChunkInvalid, chunk.Path, asset.ID,
+						fmt.Sprintf("Volume index %d is greater than the volume count %d",
+							chunk.Volume(), dcp.AssetMap.VolumeCount))
+				} else {
+					report.Add(SeverityWarning, CodeVolumeNotLoaded, chunk.Path, asset.ID,
+						fmt.Sprintf("Chunk is on volume %d, which isn't loaded", chunk.Volume()))
+				}
+				continue
+			}
+			name := fsName(chunk.Path)
+			contentType := UnknownAssetType
+			if chunk.Offset == 0 {
+				contentType = assetType(fsys, name)
+			}
+			for _, rule := range chunkRules {
+				rule(report, asset, chunk, fsys, name, contentType)
+			}
+			// Parse CPLs and PKLs
+			switch contentType {
+			case CPLAssetType:
+				xmlStr, err := fs.ReadFile(fsys, name)
+				var cpl *CPL
+				if err == nil {
+					cpl, err = ParseCPL(xmlStr)
+				}
+				if err != nil {
+					report.Add(SeverityError, CodeCPLInvalid, chunk.Path, asset.ID, err.Error())
+					continue
+				}
+				dcp.CPLs = append(dcp.CPLs, cpl)
+			case PKLAssetType:
+				xmlStr, err := fs.ReadFile(fsys, name)
+				var pkl *PKL
+				if err == nil {
+					pkl, err = ParsePKL(xmlStr)
+				}
+				if err != nil {
+					report.Add(SeverityError, CodePKLInvalid, chunk.Path, asset.ID, err.Error())
+					continue
+				}
+				dcp.PKLs = append(dcp.PKLs, pkl)
+			}
+		}
+	}
+}
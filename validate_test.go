@@ -0,0 +1,163 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testDCPFiles are the files of a small Interop DCP using the test CPL and
+// PKL: the picture MXF has the wrong size and the sound MXF is missing
+func testDCPFiles() map[string][]byte {
+	picture := append(append([]byte{}, mxfHeader...), make([]byte, 100)...)
+	assetMap := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<AssetMap xmlns="http://www.digicine.com/PROTO-ASDCP-AM-20040311#">
+  <Id>urn:uuid:88ef5d99-e2aa-483e-9697-943e18b77cea</Id>
+  <VolumeCount>1</VolumeCount>
+  <AssetList>
+    <Asset>
+      <Id>urn:uuid:4d9e98c3-c923-4910-ae0e-9f5951c9cc5f</Id>
+      <PackingList>true</PackingList>
+      <ChunkList><Chunk><Path>pkl.xml</Path><Length>%d</Length></Chunk></ChunkList>
+    </Asset>
+    <Asset>
+      <Id>urn:uuid:d65572db-2e09-4745-817d-a2881222e2db</Id>
+      <ChunkList><Chunk><Path>cpl.xml</Path><Length>%d</Length></Chunk></ChunkList>
+    </Asset>
+    <Asset>
+      <Id>urn:uuid:db95199c-0e2f-4ac4-9e54-b97919dcdf07</Id>
+      <ChunkList><Chunk><Path>video.mxf</Path><Length>%d</Length></Chunk></ChunkList>
+    </Asset>
+    <Asset>
+      <Id>urn:uuid:5fbb3067-4166-4a19-9ba2-0a2b4c5cd397</Id>
+      <ChunkList><Chunk><Path>audio.mxf</Path><Length>1</Length></Chunk></ChunkList>
+    </Asset>
+  </AssetList>
+</AssetMap>`, len(testPKLXML), len(testCPLXML), len(picture)+1)
+	return map[string][]byte{
+		"ASSETMAP":  []byte(assetMap),
+		"pkl.xml":   testPKLXML,
+		"cpl.xml":   testCPLXML,
+		"video.mxf": picture,
+	}
+}
+
+// writeTestDCP writes the test DCP files to a temporary directory
+func writeTestDCP(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dcp")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	for name, content := range testDCPFiles() {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	return dir
+}
+
+func TestValidate(t *testing.T) {
+	dir := writeTestDCP(t)
+	defer os.RemoveAll(dir)
+	dcp := &DCP{}
+	report := dcp.Validate(dir)
+	// Both defects should be reported, not just the first
+	errs := report.Filter(SeverityError)
+	if len(errs) != 2 {
+		t.Fatalf("Error count is incorrect: %d != %d", len(errs), 2)
+	}
+	if errs[0].Code != CodeAssetSize || errs[0].File != "video.mxf" {
+		t.Errorf("First error is incorrect: %s %s", errs[0].Code, errs[0].File)
+	}
+	if errs[1].Code != CodeAssetMissing ||
+		errs[1].AssetID != "urn:uuid:5fbb3067-4166-4a19-9ba2-0a2b4c5cd397" {
+		t.Errorf("Second error is incorrect: %s %s", errs[1].Code, errs[1].AssetID)
+	}
+	if report.MaxSeverity() != SeverityError {
+		t.Errorf("Max severity is incorrect: %s != %s", report.MaxSeverity(), SeverityError)
+	}
+	// The CPL and PKL are still parsed
+	if len(dcp.CPLs) != 1 || len(dcp.PKLs) != 1 {
+		t.Errorf("CPL and PKL counts are incorrect: %d, %d", len(dcp.CPLs), len(dcp.PKLs))
+	}
+}
+
+func TestGenerateFirstError(t *testing.T) {
+	dir := writeTestDCP(t)
+	defer os.RemoveAll(dir)
+	dcp := &DCP{}
+	err := dcp.Generate(dir)
+	finding, ok := err.(*Finding)
+	if !ok || finding.Code != CodeAssetSize {
+		t.Errorf("Generate should fail with the first error: %v", err)
+	}
+}
+
+func TestValidateNoAssetMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcp")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	report := (&DCP{}).Validate(dir)
+	if len(report.Findings) != 1 || report.Findings[0].Code != CodeAssetMapNotFound {
+		t.Errorf("Missing assetmap should be reported")
+	}
+}
+
+// openCountFS counts how many times each file is opened
+type openCountFS struct {
+	fstest.MapFS
+	opens map[string]int
+}
+
+func (fsys *openCountFS) Open(name string) (fs.File, error) {
+	fsys.opens[name]++
+	return fsys.MapFS.Open(name)
+}
+
+func TestCheckChunkType(t *testing.T) {
+	fsys := &openCountFS{MapFS: fstest.MapFS{}, opens: map[string]int{}}
+	for name, content := range testDCPFiles() {
+		fsys.MapFS[name] = &fstest.MapFile{Data: content}
+	}
+	// The assetmap names a CPL, but the file holds a PKL
+	fsys.MapFS["cpl.xml"] = &fstest.MapFile{Data: testPKLXML}
+	report := (&DCP{}).ValidateFS(fsys, ".")
+	found := false
+	for _, f := range report.Findings {
+		if f.Code == CodeAssetType && f.File == "cpl.xml" {
+			found = true
+			if !strings.Contains(f.Message, "PKL != CPL") {
+				t.Errorf("Asset types should be named: %s", f.Message)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Asset type mismatch not reported: %v", report.Findings)
+	}
+	// The header is read once for every rule
+	if fsys.opens["video.mxf"] != 1 {
+		t.Errorf("Picture was opened %d times", fsys.opens["video.mxf"])
+	}
+}
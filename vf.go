@@ -0,0 +1,83 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Version files (VFs), supplemental DCPs whose CPLs use reel assets held in
+another DCP, the original version (OV); a VF is playable once every reel
+asset is resolved in either
+*/
+
+package dcp
+
+// CodeReelAssetUnresolved is reported for reel assets of a VF found in
+// neither the VF nor any of the OVs
+const CodeReelAssetUnresolved Code = "REEL_ASSET_UNRESOLVED"
+
+// IsVF reports whether any reel asset is in neither the DCP's PKLs nor its
+// asset map, so the DCP needs an OV to be played
+func (dcp *DCP) IsVF() bool {
+	for _, ra := range dcp.ResolveAssets() {
+		if ra.PKLAsset == nil && ra.Path == "" {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ResolveVF resolves the reel assets of the DCP's CPLs, looking for those the
+DCP doesn't hold in each of the candidate OVs in turn; Package is the OV an
+asset was found in, whose AssetReader reads it. Assets found in none are
+left unresolved, with no Package
+*/
+func (dcp *DCP) ResolveVF(ovs ...*DCP) []*ResolvedAsset {
+	resolved := dcp.ResolveAssets()
+	for _, ra := range resolved {
+		if ra.PKLAsset != nil || ra.Path != "" {
+			continue
+		}
+		ra.Package = nil
+		for _, ov := range ovs {
+			pkl, pklAsset := ov.pklAsset(ra.Asset.ID)
+			path := firstPath(ov.assetMapAsset(ra.Asset.ID))
+			if pklAsset != nil && path != "" {
+				ra.PKLID, ra.PKLAsset, ra.Path, ra.Package = pkl.ID, pklAsset, path, ov
+				break
+			}
+		}
+	}
+	return resolved
+}
+
+/*
+CheckVF adds an error to the report for each reel asset of the VF resolved
+in none of the OVs, or whose hash differs from the OV's PKL; the VF is
+playable with the OVs if none are reported
+*/
+func CheckVF(vf *DCP, ovs []*DCP, report *Report) {
+	for _, ra := range vf.ResolveVF(ovs...) {
+		switch {
+		case ra.Package == vf:
+			// Checked against the VF's own PKLs by checkCrossReferences
+		case !ra.Resolved():
+			report.Add(SeverityError, CodeReelAssetUnresolved, "", ra.Asset.ID,
+				"Asset in reel "+ra.ReelID+" of CPL "+ra.CPLID+" is not in any OV")
+		case ra.Asset.Hash != "" && ra.Asset.Hash != ra.PKLAsset.Hash:
+			report.Add(SeverityError, CodeReelAssetHash, ra.Path, ra.Asset.ID,
+				"Hash in reel "+ra.ReelID+" of CPL "+ra.CPLID+" does not match the OV's PKL: "+
+					ra.Asset.Hash+" != "+ra.PKLAsset.Hash)
+		}
+	}
+}
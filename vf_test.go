@@ -0,0 +1,77 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"testing"
+)
+
+// makeVF builds a VF holding only the test CPL, whose assets are in the OV
+// built from the test documents
+func makeVF(t *testing.T) (*DCP, *DCP) {
+	ov := &DCP{AssetMap: parseAM(t), CPLs: []*CPL{parseCPL(t)}, PKLs: []*PKL{parsePKL(t)}}
+	vf := &DCP{AssetMap: &AssetMap{}, CPLs: []*CPL{parseCPL(t)}, VF: true}
+	return vf, ov
+}
+
+func TestResolveVF(t *testing.T) {
+	vf, ov := makeVF(t)
+	if !vf.IsVF() || ov.IsVF() {
+		t.Errorf("Only the VF should need an OV: %t %t", vf.IsVF(), ov.IsVF())
+	}
+	resolved := vf.ResolveVF(makeResolveDCP(t), ov)
+	if len(resolved) != 2 {
+		t.Fatalf("Resolved asset count is incorrect: %d != %d", len(resolved), 2)
+	}
+	for _, ra := range resolved {
+		if !ra.Resolved() {
+			t.Errorf("Asset %s should be resolved", ra.Asset.ID)
+		}
+	}
+	// The first OV lacks the sound in its PKL, so it's found in the second
+	if resolved[0].Package == ov || resolved[1].Package != ov {
+		t.Errorf("Assets should be resolved in the first OV holding them")
+	}
+	expectedPath := "bewegte_bilder-tricks17-test_film-full_content-51-j2k_video.mxf"
+	if resolved[0].Path != expectedPath {
+		t.Errorf("Picture path is incorrect: %s != %s", resolved[0].Path, expectedPath)
+	}
+}
+
+func TestCheckVF(t *testing.T) {
+	vf, _ := makeVF(t)
+	report := &Report{}
+	checkCrossReferences(vf, report)
+	if warnings := report.Filter(SeverityWarning); len(warnings) != 2 ||
+		warnings[0].Code != CodeReelAssetExternal {
+		t.Errorf("Assets in an OV should be warned about: %v", warnings)
+	}
+	// Unless the caller says the DCP is a VF the assets are dangling
+	ov := &DCP{AssetMap: vf.AssetMap, CPLs: vf.CPLs}
+	report = &Report{}
+	checkCrossReferences(ov, report)
+	if errors := report.Filter(SeverityError); len(errors) != 5 ||
+		errors[0].Code != CodeReelAssetNotInPKL || errors[1].Code != CodeReelAssetNotInAssetMap ||
+		len(report.Filter(SeverityWarning)) != 0 {
+		t.Errorf("Assets missing from an OV should be errors: %v", report.Findings)
+	}
+	report = &Report{}
+	CheckVF(vf, []*DCP{makeResolveDCP(t)}, report)
+	if len(report.Findings) != 1 || report.Findings[0].Code != CodeReelAssetUnresolved ||
+		report.Findings[0].AssetID != "urn:uuid:5fbb3067-4166-4a19-9ba2-0a2b4c5cd397" {
+		t.Errorf("Sound missing from the OV should be reported: %v", report.Findings)
+	}
+}
@@ -0,0 +1,292 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Multi-volume DCPs, whose assets are split into chunks across several
+volumes such as delivery drives; each volume has an assetmap and a VOLINDEX
+file giving its index
+*/
+
+package dcp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// Volume is a volume the DCP was loaded from
+type Volume struct {
+	Index   int    // from the volume's VOLINDEX, starting at 1
+	RootDir string // root directory of the volume
+}
+
+// VolumeIndex is a VOLINDEX document, which identifies a volume
+type VolumeIndex struct {
+	Format Format
+	Index  int
+}
+
+// Multi-volume validation codes
+const (
+	CodeVolumeIndexInvalid Code = "VOLINDEX_INVALID"
+	CodeVolumeDuplicate    Code = "VOLUME_DUPLICATE"
+	CodeVolumeMismatch     Code = "VOLUME_ASSETMAP_MISMATCH"
+	CodeVolumeNotLoaded    Code = "VOLUME_NOT_LOADED"
+	CodeChunkInvalid       Code = "CHUNK_INVALID"
+)
+
+// volIndexRegExp matches the file names of VOLINDEX files
+var volIndexRegExp = regexp.MustCompile(`^(volindex|VOLINDEX)(.xml|.XML)*$`)
+
+// ParseVolumeIndexFile parses a VOLINDEX file, whose file path is filename
+func ParseVolumeIndexFile(filename string) (*VolumeIndex, error) {
+	xmlStr, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseVolumeIndex(xmlStr)
+}
+
+// ParseVolumeIndex parses a VOLINDEX XML string
+func ParseVolumeIndex(xmlStr []byte) (*VolumeIndex, error) {
+	var viXML volumeIndexXML
+	if err := xml.Unmarshal(xmlStr, &viXML); err != nil {
+		return nil, err
+	}
+	vi := &VolumeIndex{Index: viXML.Index}
+	switch viXML.Xmlns {
+	case interopAMNamespace:
+		vi.Format = INTEROP
+	case smpteAMNamespace:
+		vi.Format = SMPTE
+	}
+	if vi.Index < 1 {
+		return nil, fmt.Errorf("Invalid volume index: %d", vi.Index)
+	}
+	return vi, nil
+}
+
+// MarshalVolumeIndex produces the VOLINDEX document; the namespace is chosen
+// from the volume index's Format
+func MarshalVolumeIndex(vi *VolumeIndex) ([]byte, error) {
+	viXML := &volumeIndexXML{XMLName: xml.Name{Local: "VolumeIndex"}, Index: vi.Index}
+	switch vi.Format {
+	case INTEROP:
+		viXML.Xmlns = interopAMNamespace
+	case SMPTE:
+		viXML.Xmlns = smpteAMNamespace
+	default:
+		return nil, fmt.Errorf("Unable to marshal a volume index of unknown format")
+	}
+	return marshalXML(viXML)
+}
+
+// volumeIndexXML is used to unmarshall the XML; used internally only
+type volumeIndexXML struct {
+	XMLName xml.Name
+	Xmlns   string `xml:"xmlns,attr"`
+	Index   int
+}
+
+// findVolumeIndex reads the VOLINDEX at the root of a file system; it
+// returns nil if there isn't one
+func findVolumeIndex(fsys fs.FS) (string, *VolumeIndex, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return "", nil, err
+	}
+	for _, f := range files {
+		if volIndexRegExp.MatchString(f.Name()) {
+			xmlStr, err := fs.ReadFile(fsys, f.Name())
+			if err != nil {
+				return f.Name(), nil, err
+			}
+			vi, err := ParseVolumeIndex(xmlStr)
+			return f.Name(), vi, err
+		}
+	}
+	return "", nil, nil
+}
+
+// GenerateVolumes builds a DCP from the root directories of its volumes,
+// given in any order; it returns the first error found
+func (dcp *DCP) GenerateVolumes(dirs ...string) error {
+	return dcp.ValidateVolumes(dirs...).Err()
+}
+
+// ValidateVolumes is Validate for a DCP on several volumes, whose root
+// directories are given in any order
+func (dcp *DCP) ValidateVolumes(dirs ...string) *Report {
+	var volumes []fs.FS
+	for _, dir := range dirs {
+		volumes = append(volumes, os.DirFS(dir))
+	}
+	return dcp.validate(volumes, dirs)
+}
+
+// OpenVolumesFS builds a DCP from its volumes, each being the root of a file
+// system; it returns the first error found
+func OpenVolumesFS(volumes ...fs.FS) (*DCP, error) {
+	dcp := &DCP{}
+	rootDirs := make([]string, len(volumes))
+	for i := range volumes {
+		rootDirs[i] = "."
+	}
+	if err := dcp.validate(volumes, rootDirs).Err(); err != nil {
+		return nil, err
+	}
+	return dcp, nil
+}
+
+/*
+loadVolume reads the assetmap and VOLINDEX of a volume; the volume's index
+is position if it has no VOLINDEX. The volume is added to the DCP, and the
+first volume's assetmap becomes the DCP's
+*/
+func (dcp *DCP) loadVolume(fsys fs.FS, rootDir string, position int, report *Report) {
+	amFileName, err := findAssetMap(fsys)
+	if pathErr, ok := err.(*fs.PathError); ok {
+		// The path is relative to fsys, and rootDir is more helpful
+		err = pathErr.Err
+	}
+	if err != nil {
+		report.Add(SeverityError, CodeAssetMapNotFound, rootDir, "", err.Error())
+		return
+	}
+	amFile, err := fs.ReadFile(fsys, amFileName)
+	if err != nil {
+		report.Add(SeverityError, CodeAssetMapInvalid, amFileName, "", err.Error())
+		return
+	}
+	am, err := ParseAssetMap(amFile)
+	if err != nil {
+		report.Add(SeverityError, CodeAssetMapInvalid, amFileName, "", err.Error())
+		return
+	}
+	index := position
+	viFileName, vi, err := findVolumeIndex(fsys)
+	if err != nil {
+		report.Add(SeverityError, CodeVolumeIndexInvalid, viFileName, "", err.Error())
+		return
+	}
+	if vi != nil {
+		index = vi.Index
+	}
+	if dcp.volumes[index] != nil {
+		report.Add(SeverityError, CodeVolumeDuplicate, rootDir, "",
+			fmt.Sprintf("Volume %d has already been loaded", index))
+		return
+	}
+	if dcp.AssetMap == nil {
+		dcp.RootDir = rootDir
+		dcp.assetMapFile = amFileName
+		dcp.AssetMap = am
+	} else if am.ID != dcp.AssetMap.ID {
+		report.Add(SeverityError, CodeVolumeMismatch, amFileName, am.ID,
+			"Assetmap differs from the first volume's: "+dcp.AssetMap.ID)
+		return
+	}
+	if dcp.volumes == nil {
+		dcp.volumes = map[int]fs.FS{}
+	}
+	dcp.volumes[index] = fsys
+	dcp.Volumes = append(dcp.Volumes, &Volume{index, rootDir})
+}
+
+// volume returns the file system of a loaded volume, or nil
+func (dcp *DCP) volume(index int) fs.FS {
+	if dcp.volumes == nil && index == 1 {
+		return os.DirFS(dcp.RootDir)
+	}
+	return dcp.volumes[index]
+}
+
+// openChunk opens the file of a chunk, on the chunk's volume
+func (dcp *DCP) openChunk(chunk *Chunk) (fs.File, error) {
+	fsys := dcp.volume(chunk.Volume())
+	if fsys == nil {
+		return nil, fmt.Errorf("%s is on volume %d, which isn't loaded",
+			chunk.Path, chunk.Volume())
+	}
+	return fsys.Open(fsName(chunk.Path))
+}
+
+/*
+AssetReader reads an asset's file, reassembled from its chunks in order of
+their offsets; the chunks may be on several volumes, which must all be
+loaded
+*/
+func (dcp *DCP) AssetReader(asset *AMAsset) (io.ReadCloser, error) {
+	chunks := append([]*Chunk{}, asset.Chunks...)
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Offset < chunks[j].Offset })
+	var offset uint64
+	for _, chunk := range chunks {
+		if chunk.Offset != offset {
+			return nil, fmt.Errorf("Chunk %s of asset %s starts at %d, expected %d",
+				chunk.Path, asset.ID, chunk.Offset, offset)
+		}
+		if dcp.volume(chunk.Volume()) == nil {
+			return nil, fmt.Errorf("%s is on volume %d, which isn't loaded",
+				chunk.Path, chunk.Volume())
+		}
+		offset += chunk.Size
+	}
+	return &chunkReader{dcp: dcp, chunks: chunks}, nil
+}
+
+// chunkReader reads a sequence of chunks, opening each in turn
+type chunkReader struct {
+	dcp     *DCP
+	chunks  []*Chunk
+	current fs.File
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			file, err := r.dcp.openChunk(r.chunks[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.chunks = file, r.chunks[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
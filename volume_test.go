@@ -0,0 +1,160 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package dcp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+)
+
+var testVolumeIndexXML = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<VolumeIndex xmlns="http://www.smpte-ra.org/schemas/429-9/2007/AM">
+  <Index>2</Index>
+</VolumeIndex>`)
+
+func TestParseVolumeIndex(t *testing.T) {
+	vi, err := ParseVolumeIndex(testVolumeIndexXML)
+	if err != nil {
+		t.Fatalf("Error parsing volume index: %s", err)
+	}
+	if vi.Format != SMPTE || vi.Index != 2 {
+		t.Errorf("Volume index is incorrect: %d %d", vi.Format, vi.Index)
+	}
+	xmlStr, err := MarshalVolumeIndex(vi)
+	if err != nil {
+		t.Fatalf("Error marshalling volume index: %s", err)
+	}
+	if parsed, err := ParseVolumeIndex(xmlStr); err != nil || *parsed != *vi {
+		t.Errorf("Volume index is incorrect after a round trip: %s", xmlStr)
+	}
+	if _, err := ParseVolumeIndex([]byte(`<VolumeIndex><Index>0</Index></VolumeIndex>`)); err == nil {
+		t.Error("Volume index 0 parsed")
+	}
+}
+
+// testVolumes returns two volumes of a DCP whose picture is split across
+// them, and the picture's content
+func testVolumes() (fstest.MapFS, fstest.MapFS, []byte) {
+	picture := append(append([]byte{}, mxfHeader...), bytes.Repeat([]byte{1, 2, 3}, 100)...)
+	sum := sha1.Sum(picture)
+	pkl := []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<PackingList xmlns="http://www.digicine.com/PROTO-ASDCP-PKL-20040311#">
+  <Id>urn:uuid:4d9e98c3-c923-4910-ae0e-9f5951c9cc5f</Id>
+  <AssetList>
+    <Asset>
+      <Id>urn:uuid:db95199c-0e2f-4ac4-9e54-b97919dcdf07</Id>
+      <Hash>%s</Hash>
+      <Size>%d</Size>
+      <Type>application/x-smpte-mxf;asdcpKind=Picture</Type>
+    </Asset>
+  </AssetList>
+</PackingList>`, base64.StdEncoding.EncodeToString(sum[:]), len(picture)))
+	assetMap := []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<AssetMap xmlns="http://www.digicine.com/PROTO-ASDCP-AM-20040311#">
+  <Id>urn:uuid:88ef5d99-e2aa-483e-9697-943e18b77cea</Id>
+  <VolumeCount>2</VolumeCount>
+  <AssetList>
+    <Asset>
+      <Id>urn:uuid:4d9e98c3-c923-4910-ae0e-9f5951c9cc5f</Id>
+      <PackingList>true</PackingList>
+      <ChunkList><Chunk><Path>pkl.xml</Path><Length>%d</Length></Chunk></ChunkList>
+    </Asset>
+    <Asset>
+      <Id>urn:uuid:db95199c-0e2f-4ac4-9e54-b97919dcdf07</Id>
+      <ChunkList>
+        <Chunk><Path>video.mxf</Path><VolumeIndex>1</VolumeIndex><Length>100</Length></Chunk>
+        <Chunk><Path>video.mxf</Path><VolumeIndex>2</VolumeIndex><Offset>100</Offset><Length>%d</Length></Chunk>
+      </ChunkList>
+    </Asset>
+  </AssetList>
+</AssetMap>`, len(pkl), len(picture)-100))
+	volIndex := func(i int) []byte {
+		return []byte(fmt.Sprintf(`<VolumeIndex xmlns="http://www.digicine.com/PROTO-ASDCP-AM-20040311#"><Index>%d</Index></VolumeIndex>`, i))
+	}
+	vol1 := fstest.MapFS{
+		"ASSETMAP":  {Data: assetMap},
+		"VOLINDEX":  {Data: volIndex(1)},
+		"pkl.xml":   {Data: pkl},
+		"video.mxf": {Data: picture[:100]},
+	}
+	vol2 := fstest.MapFS{
+		"ASSETMAP":  {Data: assetMap},
+		"VOLINDEX":  {Data: volIndex(2)},
+		"video.mxf": {Data: picture[100:]},
+	}
+	return vol1, vol2, picture
+}
+
+func TestOpenVolumesFS(t *testing.T) {
+	vol1, vol2, picture := testVolumes()
+	// Volumes can be given in any order
+	dcp, err := OpenVolumesFS(vol2, vol1)
+	if err != nil {
+		t.Fatalf("Error opening volumes: %s", err)
+	}
+	if len(dcp.Volumes) != 2 || dcp.Volumes[0].Index != 2 || dcp.Volumes[1].Index != 1 {
+		t.Errorf("Volumes are incorrect: %+v", dcp.Volumes)
+	}
+	asset := dcp.AssetMap.Asset("urn:uuid:db95199c-0e2f-4ac4-9e54-b97919dcdf07")
+	r, err := dcp.AssetReader(asset)
+	if err != nil {
+		t.Fatalf("Error reading asset: %s", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(data, picture) {
+		t.Errorf("Reassembled asset is incorrect: %d bytes, %v", len(data), err)
+	}
+	report := &Report{}
+	CheckHashes(dcp, report)
+	if len(report.Findings) != 0 {
+		t.Errorf("Hash of the split asset should match: %v", report.Findings)
+	}
+}
+
+func TestValidateOneVolume(t *testing.T) {
+	vol1, _, _ := testVolumes()
+	dcp := &DCP{}
+	report := dcp.validate([]fs.FS{vol1}, []string{"vol1"})
+	if report.MaxSeverity() != SeverityWarning {
+		t.Errorf("Only warnings should be found: %v", report.Findings)
+	}
+	if warnings := report.Filter(SeverityWarning); len(warnings) != 1 ||
+		warnings[0].Code != CodeVolumeNotLoaded {
+		t.Errorf("Missing volume should be reported: %v", warnings)
+	}
+	asset := dcp.AssetMap.Asset("urn:uuid:db95199c-0e2f-4ac4-9e54-b97919dcdf07")
+	if _, err := dcp.AssetReader(asset); err == nil {
+		t.Error("Asset on a missing volume read")
+	}
+}
+
+func TestValidateVolumesMismatch(t *testing.T) {
+	vol1, vol2, _ := testVolumes()
+	vol2["ASSETMAP"] = &fstest.MapFile{Data: bytes.Replace(vol2["ASSETMAP"].Data,
+		[]byte("88ef5d99"), []byte("00000000"), 1)}
+	report := (&DCP{}).validate([]fs.FS{vol1, vol2}, []string{"vol1", "vol2"})
+	errs := report.Filter(SeverityError)
+	if len(errs) != 1 || errs[0].Code != CodeVolumeMismatch {
+		t.Errorf("Mismatched assetmaps should be reported: %v", errs)
+	}
+}
@@ -0,0 +1,375 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+/*
+Package xmldsig verifies the enveloped XML signatures (XML-DSig) carried by
+SMPTE CPLs, PKLs and KDMs.
+*/
+package xmldsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// xmlNamespace is bound to the xml prefix without being declared
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// nodeKind is the kind of a node in a parsed document
+type nodeKind int
+
+const (
+	documentNode nodeKind = iota
+	elementNode
+	textNode
+	commentNode
+	procInstNode
+)
+
+/*
+node is a node of a parsed document; element names and attributes keep the
+prefixes written in the document, which canonicalization needs
+*/
+type node struct {
+	kind     nodeKind
+	name     xml.Name   // element name; Space holds the prefix
+	attrs    []xml.Attr // attributes, including namespace declarations
+	text     string     // text, comment or processing instruction data
+	target   string     // processing instruction target
+	parent   *node
+	children []*node
+}
+
+// parseDocument parses an XML document into a tree of nodes; the returned
+// node is the document node, whose children are the top level nodes
+func parseDocument(doc []byte) (*node, error) {
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	root := &node{kind: documentNode}
+	current := root
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{kind: elementNode, name: t.Name, attrs: t.Attr, parent: current}
+			current.children = append(current.children, n)
+			current = n
+		case xml.EndElement:
+			if current == root || current.name != t.Name {
+				return nil, errors.New("Mismatched end element: " + qualifiedName(t.Name))
+			}
+			current = current.parent
+		case xml.CharData:
+			current.children = append(current.children,
+				&node{kind: textNode, text: string(t), parent: current})
+		case xml.Comment:
+			current.children = append(current.children,
+				&node{kind: commentNode, text: string(t), parent: current})
+		case xml.ProcInst:
+			if t.Target == "xml" {
+				// The XML declaration isn't part of the canonical form
+				continue
+			}
+			current.children = append(current.children,
+				&node{kind: procInstNode, target: t.Target, text: string(t.Inst), parent: current})
+		}
+	}
+	if current != root {
+		return nil, errors.New("Unexpected end of document")
+	}
+	if root.documentElement() == nil {
+		return nil, errors.New("Document has no root element")
+	}
+	return root, nil
+}
+
+// documentElement returns the root element of a document node
+func (n *node) documentElement() *node {
+	for _, child := range n.children {
+		if child.kind == elementNode {
+			return child
+		}
+	}
+	return nil
+}
+
+// namespaces returns the namespace prefixes in scope at an element, with
+// the default namespace under the empty prefix
+func (n *node) namespaces() map[string]string {
+	ns := map[string]string{}
+	var chain []*node
+	for e := n; e != nil && e.kind == elementNode; e = e.parent {
+		chain = append(chain, e)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, attr := range chain[i].attrs {
+			if attr.Name.Space == "xmlns" {
+				ns[attr.Name.Local] = attr.Value
+			} else if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+				ns[""] = attr.Value
+			}
+		}
+	}
+	return ns
+}
+
+// namespace resolves the namespace of an element
+func (n *node) namespace() string {
+	return n.namespaces()[n.name.Space]
+}
+
+// is checks an element's namespace and local name
+func (n *node) is(namespace, local string) bool {
+	return n.kind == elementNode && n.name.Local == local && n.namespace() == namespace
+}
+
+// child returns the first child element with the given namespace and
+// local name
+func (n *node) child(namespace, local string) *node {
+	for _, c := range n.children {
+		if c.is(namespace, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// childElements returns the child elements with the given namespace and
+// local name
+func (n *node) childElements(namespace, local string) []*node {
+	var elements []*node
+	for _, c := range n.children {
+		if c.is(namespace, local) {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+// attr returns the value of an unprefixed attribute
+func (n *node) attr(local string) string {
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// textContent returns the concatenated text of an element
+func (n *node) textContent() string {
+	var s string
+	for _, c := range n.children {
+		switch c.kind {
+		case textNode:
+			s += c.text
+		case elementNode:
+			s += c.textContent()
+		}
+	}
+	return s
+}
+
+// isNamespaceDecl checks if an attribute declares a namespace
+func isNamespaceDecl(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns")
+}
+
+// qualifiedName writes a raw name with its prefix
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+/*
+canonicalizer writes the canonical form of a node-set, as defined by
+Canonical XML 1.0 and Exclusive XML Canonicalization 1.0; the node-set is a
+subtree, less one excluded element for the enveloped signature transform
+*/
+type canonicalizer struct {
+	exclusive bool
+	comments  bool
+	inclusive map[string]bool // InclusiveNamespaces PrefixList for exclusive c14n
+	exclude   *node
+	buf       bytes.Buffer
+}
+
+// canonicalize writes the canonical form of a document or element subtree
+func (c *canonicalizer) canonicalize(n *node) []byte {
+	if n.kind == documentNode {
+		c.document(n)
+	} else {
+		// The apex of a subtree has no rendered ancestors
+		c.element(n, map[string]string{})
+	}
+	return c.buf.Bytes()
+}
+
+// document writes a whole document: nodes outside the root element are
+// separated from it by line feeds and text outside it is dropped
+func (c *canonicalizer) document(doc *node) {
+	seenRoot := false
+	for _, n := range doc.children {
+		switch n.kind {
+		case elementNode:
+			c.element(n, map[string]string{})
+			seenRoot = true
+		case commentNode, procInstNode:
+			if n.kind == commentNode && !c.comments {
+				continue
+			}
+			if seenRoot {
+				c.buf.WriteByte('\n')
+			}
+			c.node(n, nil)
+			if !seenRoot {
+				c.buf.WriteByte('\n')
+			}
+		}
+	}
+}
+
+// node writes any node inside the document element
+func (c *canonicalizer) node(n *node, rendered map[string]string) {
+	switch n.kind {
+	case elementNode:
+		c.element(n, rendered)
+	case textNode:
+		c.buf.WriteString(escapeText(n.text))
+	case commentNode:
+		if c.comments {
+			c.buf.WriteString("<!--" + n.text + "-->")
+		}
+	case procInstNode:
+		c.buf.WriteString("<?" + n.target)
+		if n.text != "" {
+			c.buf.WriteString(" " + n.text)
+		}
+		c.buf.WriteString("?>")
+	}
+}
+
+// element writes an element and its content; rendered holds the namespace
+// declarations already output by its ancestors
+func (c *canonicalizer) element(n *node, rendered map[string]string) {
+	if n == c.exclude {
+		return
+	}
+	inScope := n.namespaces()
+	// Decide which namespace declarations to output
+	var prefixes []string
+	if c.exclusive {
+		used := map[string]bool{n.name.Space: true}
+		for _, attr := range n.attrs {
+			if !isNamespaceDecl(attr) && attr.Name.Space != "" && attr.Name.Space != "xml" {
+				used[attr.Name.Space] = true
+			}
+		}
+		for prefix := range c.inclusive {
+			if _, ok := inScope[prefix]; ok {
+				used[prefix] = true
+			}
+		}
+		for prefix := range used {
+			prefixes = append(prefixes, prefix)
+		}
+	} else {
+		for prefix := range inScope {
+			prefixes = append(prefixes, prefix)
+		}
+		if _, ok := inScope[""]; !ok {
+			prefixes = append(prefixes, "")
+		}
+	}
+	sort.Strings(prefixes)
+	childRendered := map[string]string{}
+	for prefix, uri := range rendered {
+		childRendered[prefix] = uri
+	}
+	var nsDecls []string
+	for _, prefix := range prefixes {
+		uri := inScope[prefix]
+		if prev, ok := rendered[prefix]; (ok && prev == uri) || (!ok && prefix == "" && uri == "") {
+			continue
+		}
+		childRendered[prefix] = uri
+		if prefix == "" {
+			nsDecls = append(nsDecls, ` xmlns="`+escapeAttr(uri)+`"`)
+		} else {
+			nsDecls = append(nsDecls, ` xmlns:`+prefix+`="`+escapeAttr(uri)+`"`)
+		}
+	}
+	// Attributes are sorted by namespace URI then local name
+	var attrs []xml.Attr
+	for _, attr := range n.attrs {
+		if !isNamespaceDecl(attr) {
+			attrs = append(attrs, attr)
+		}
+	}
+	attrNamespace := func(attr xml.Attr) string {
+		if attr.Name.Space == "xml" {
+			return xmlNamespace
+		}
+		if attr.Name.Space == "" {
+			return ""
+		}
+		return inScope[attr.Name.Space]
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		nsi, nsj := attrNamespace(attrs[i]), attrNamespace(attrs[j])
+		if nsi != nsj {
+			return nsi < nsj
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+	c.buf.WriteString("<" + qualifiedName(n.name))
+	for _, decl := range nsDecls {
+		c.buf.WriteString(decl)
+	}
+	for _, attr := range attrs {
+		c.buf.WriteString(" " + qualifiedName(attr.Name) + `="` + escapeAttr(attr.Value) + `"`)
+	}
+	c.buf.WriteString(">")
+	for _, child := range n.children {
+		c.node(child, childRendered)
+	}
+	c.buf.WriteString("</" + qualifiedName(n.name) + ">")
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+	"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+// escapeText escapes a text node for the canonical form
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// escapeAttr escapes an attribute value for the canonical form
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
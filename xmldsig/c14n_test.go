@@ -0,0 +1,109 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package xmldsig
+
+import (
+	"testing"
+)
+
+// Example 3.3 of Canonical XML 1.0, without the DTD
+var testStartEndXML = []byte(`<?xml version="1.0"?>
+<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>
+<!-- comment -->`)
+
+var testStartEndC14N = `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`
+
+func TestC14NDocument(t *testing.T) {
+	root, err := parseDocument(testStartEndXML)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	c := &canonicalizer{}
+	if s := string(c.canonicalize(root)); s != testStartEndC14N {
+		t.Errorf("Canonical form is incorrect:\n%s\n!=\n%s", s, testStartEndC14N)
+	}
+	c = &canonicalizer{comments: true}
+	expected := testStartEndC14N + "\n<!-- comment -->"
+	if s := string(c.canonicalize(root)); s != expected {
+		t.Errorf("Canonical form with comments is incorrect:\n%s\n!=\n%s", s, expected)
+	}
+}
+
+// Example from section 2.2 of Exclusive XML Canonicalization 1.0
+var testExcXML = []byte(`<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"/></n1:elem2></n0:local>`)
+
+func TestC14NSubtree(t *testing.T) {
+	root, err := parseDocument(testExcXML)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	elem2 := root.documentElement().children[0]
+	c := &canonicalizer{}
+	expected := `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en"><n3:stuff></n3:stuff></n1:elem2>`
+	if s := string(c.canonicalize(elem2)); s != expected {
+		t.Errorf("Inclusive canonical form is incorrect:\n%s\n!=\n%s", s, expected)
+	}
+	c = &canonicalizer{exclusive: true}
+	expected = `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2>`
+	if s := string(c.canonicalize(elem2)); s != expected {
+		t.Errorf("Exclusive canonical form is incorrect:\n%s\n!=\n%s", s, expected)
+	}
+	c = &canonicalizer{exclusive: true, inclusive: map[string]bool{"n0": true}}
+	expected = `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2>`
+	if s := string(c.canonicalize(elem2)); s != expected {
+		t.Errorf("Exclusive canonical form with a prefix list is incorrect:\n%s\n!=\n%s", s, expected)
+	}
+}
+
+func TestC14NEscaping(t *testing.T) {
+	root, err := parseDocument([]byte("<a b=\"&quot;&#x9;&lt;\">&amp;&gt;&#xD;</a>"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	expected := "<a b=\"&quot;&#x9;&lt;\">&amp;&gt;&#xD;</a>"
+	if s := string((&canonicalizer{}).canonicalize(root)); s != expected {
+		t.Errorf("Escaping is incorrect: %s != %s", s, expected)
+	}
+}
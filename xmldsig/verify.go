@@ -0,0 +1,441 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package xmldsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Namespace of the XML-DSig elements
+const dsigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+
+// Algorithm identifiers
+const (
+	C14N                 = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	C14NWithComments     = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments"
+	ExcC14N              = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	ExcC14NWithComments  = "http://www.w3.org/2001/10/xml-exc-c14n#WithComments"
+	EnvelopedSignature   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	RSASHA1              = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	RSASHA256            = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	SHA1                 = "http://www.w3.org/2000/09/xmldsig#sha1"
+	SHA256               = "http://www.w3.org/2001/04/xmlenc#sha256"
+	exclusiveNamespaceNS = "http://www.w3.org/2001/10/xml-exc-c14n#"
+)
+
+// ErrUnsigned is returned when a document has no signature
+var ErrUnsigned = errors.New("Document is not signed")
+
+/*
+Options controls the checks made on the certificate chain of a signature.
+Roots are the trusted root certificates, one of which must be or issue the
+top of the chain. When Roots is nil only the structure of the chain is
+checked; anyone can make a chain that passes, so the signer isn't
+authenticated. Every certificate must be valid at Time, which should be
+when the document was signed, such as its IssueDate, so that archived
+documents still verify; the zero Time is the current time
+*/
+type Options struct {
+	Roots *x509.CertPool
+	Time  time.Time
+}
+
+// Verify checks the enveloped signature of an XML document: the digest of
+// every reference and the signature over SignedInfo. It returns the
+// certificate chain from KeyInfo, starting with the signer's certificate
+func Verify(doc []byte, opts Options) ([]*x509.Certificate, error) {
+	return verify(doc, opts, nil)
+}
+
+// VerifyDocument is Verify for documents that must be signed as a whole,
+// such as CPLs and PKLs: one reference must be to the document element,
+// with the enveloped signature transform. Otherwise the signed content
+// could be moved under another element and the document changed around it
+func VerifyDocument(doc []byte, opts Options) ([]*x509.Certificate, error) {
+	return verify(doc, opts, func(root *node, references []*node) error {
+		for _, reference := range references {
+			if coversDocument(root, reference) {
+				return nil
+			}
+		}
+		return errors.New("Signature has no reference to the whole document")
+	})
+}
+
+/*
+VerifyElements is Verify for documents that sign some of the document
+element's children, such as the AuthenticatedPublic and AuthenticatedPrivate
+parts of a KDM: each child named in elements, in the document element's
+namespace, must be the target of a reference to its Id
+*/
+func VerifyElements(doc []byte, opts Options, elements ...string) ([]*x509.Certificate, error) {
+	return verify(doc, opts, func(root *node, references []*node) error {
+		docElement := root.documentElement()
+		for _, name := range elements {
+			element := docElement.child(docElement.namespace(), name)
+			if element == nil {
+				return errors.New("Document has no " + name)
+			}
+			if !referencesElement(root, references, element) {
+				return errors.New("Signature has no reference to " + name)
+			}
+		}
+		return nil
+	})
+}
+
+// verify checks a signature; covered, if not nil, checks the references
+// cover what the document needs signed
+func verify(doc []byte, opts Options,
+	covered func(root *node, references []*node) error) ([]*x509.Certificate, error) {
+	root, err := parseDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	signature := root.documentElement().child(dsigNamespace, "Signature")
+	if signature == nil {
+		return nil, ErrUnsigned
+	}
+	signedInfo := signature.child(dsigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return nil, errors.New("Signature has no SignedInfo")
+	}
+	// Check the digest of each reference
+	references := signedInfo.childElements(dsigNamespace, "Reference")
+	if len(references) == 0 {
+		return nil, errors.New("SignedInfo has no Reference")
+	}
+	for _, reference := range references {
+		if err := verifyReference(root, signature, reference); err != nil {
+			return nil, err
+		}
+	}
+	if covered != nil {
+		if err := covered(root, references); err != nil {
+			return nil, err
+		}
+	}
+	// Check the signature over the canonical SignedInfo
+	chain, err := certificateChain(signature, opts)
+	if err != nil {
+		return nil, err
+	}
+	method := signedInfo.child(dsigNamespace, "CanonicalizationMethod")
+	if method == nil {
+		return nil, errors.New("SignedInfo has no CanonicalizationMethod")
+	}
+	c, err := newCanonicalizer(method)
+	if err != nil {
+		return nil, err
+	}
+	canonical := c.canonicalize(signedInfo)
+	value, err := decodeBase64(signature.child(dsigNamespace, "SignatureValue"))
+	if err != nil {
+		return nil, err
+	}
+	var hash crypto.Hash
+	switch algorithm := signedInfo.child(dsigNamespace, "SignatureMethod"); {
+	case algorithm == nil:
+		return nil, errors.New("SignedInfo has no SignatureMethod")
+	case algorithm.attr("Algorithm") == RSASHA256:
+		hash = crypto.SHA256
+	case algorithm.attr("Algorithm") == RSASHA1:
+		hash = crypto.SHA1
+	default:
+		return nil, errors.New("Unsupported signature method: " + algorithm.attr("Algorithm"))
+	}
+	key, ok := chain[0].PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Signer certificate does not hold an RSA key")
+	}
+	h := hash.New()
+	h.Write(canonical)
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), value); err != nil {
+		return nil, errors.New("Signature value is incorrect: " + err.Error())
+	}
+	return chain, nil
+}
+
+// newCanonicalizer creates a canonicalizer for a CanonicalizationMethod or
+// Transform element
+func newCanonicalizer(method *node) (*canonicalizer, error) {
+	c := &canonicalizer{}
+	switch method.attr("Algorithm") {
+	case C14N:
+	case C14NWithComments:
+		c.comments = true
+	case ExcC14N:
+		c.exclusive = true
+	case ExcC14NWithComments:
+		c.exclusive = true
+		c.comments = true
+	default:
+		return nil, errors.New("Unsupported canonicalization method: " + method.attr("Algorithm"))
+	}
+	if inclusive := method.child(exclusiveNamespaceNS, "InclusiveNamespaces"); inclusive != nil {
+		c.inclusive = map[string]bool{}
+		for _, prefix := range strings.Fields(inclusive.attr("PrefixList")) {
+			if prefix == "#default" {
+				prefix = ""
+			}
+			c.inclusive[prefix] = true
+		}
+	}
+	return c, nil
+}
+
+// verifyReference applies a reference's transforms to the document and
+// checks the digest of the result
+func verifyReference(root, signature, reference *node) error {
+	uri := reference.attr("URI")
+	target := root
+	if uri != "" {
+		if !strings.HasPrefix(uri, "#") {
+			return errors.New("Unsupported reference URI: " + uri)
+		}
+		if target = findID(root, uri[1:]); target == nil {
+			return errors.New("Reference target not found: " + uri)
+		}
+	}
+	// Same document references drop comments; inclusive c14n is the default
+	c := &canonicalizer{}
+	if transforms := reference.child(dsigNamespace, "Transforms"); transforms != nil {
+		for _, transform := range transforms.childElements(dsigNamespace, "Transform") {
+			if transform.attr("Algorithm") == EnvelopedSignature {
+				c.exclude = signature
+				continue
+			}
+			tc, err := newCanonicalizer(transform)
+			if err != nil {
+				return err
+			}
+			tc.comments = false
+			tc.exclude = c.exclude
+			c = tc
+		}
+	}
+	var hash crypto.Hash
+	switch method := reference.child(dsigNamespace, "DigestMethod"); {
+	case method == nil:
+		return errors.New("Reference has no DigestMethod")
+	case method.attr("Algorithm") == SHA1:
+		hash = crypto.SHA1
+	case method.attr("Algorithm") == SHA256:
+		hash = crypto.SHA256
+	default:
+		return errors.New("Unsupported digest method: " + method.attr("Algorithm"))
+	}
+	expected, err := decodeBase64(reference.child(dsigNamespace, "DigestValue"))
+	if err != nil {
+		return err
+	}
+	var digest []byte
+	canonical := c.canonicalize(target)
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum(canonical)
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256(canonical)
+		digest = sum[:]
+	}
+	if !bytes.Equal(digest, expected) {
+		return errors.New("Digest of reference \"" + uri + "\" is incorrect")
+	}
+	return nil
+}
+
+// coversDocument checks if a reference is to the whole document, either by
+// an empty URI or the Id of the document element, with the enveloped
+// signature transform
+func coversDocument(root, reference *node) bool {
+	uri := reference.attr("URI")
+	if uri != "" && (!strings.HasPrefix(uri, "#") ||
+		findID(root, uri[1:]) != root.documentElement()) {
+		return false
+	}
+	transforms := reference.child(dsigNamespace, "Transforms")
+	if transforms == nil {
+		return false
+	}
+	for _, transform := range transforms.childElements(dsigNamespace, "Transform") {
+		if transform.attr("Algorithm") == EnvelopedSignature {
+			return true
+		}
+	}
+	return false
+}
+
+// referencesElement checks if one of references is to element by its Id
+func referencesElement(root *node, references []*node, element *node) bool {
+	for _, reference := range references {
+		uri := reference.attr("URI")
+		if strings.HasPrefix(uri, "#") && findID(root, uri[1:]) == element {
+			return true
+		}
+	}
+	return false
+}
+
+// findID finds the element whose Id attribute has the given value
+func findID(n *node, id string) *node {
+	for _, c := range n.children {
+		if c.kind != elementNode {
+			continue
+		}
+		if c.attr("Id") == id || c.attr("ID") == id || c.attr("id") == id {
+			return c
+		}
+		if found := findID(c, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+/*
+certificateChain reads the X509 certificates in KeyInfo and orders them
+from the signer to the root, checking each is signed by the next, the root
+signed itself and every certificate is valid at opts.Time. These checks are only
+structural, as KeyInfo is written by the signer; the chain is only trusted
+if it leads to one of opts.Roots
+*/
+func certificateChain(signature *node, opts Options) ([]*x509.Certificate, error) {
+	keyInfo := signature.child(dsigNamespace, "KeyInfo")
+	if keyInfo == nil {
+		return nil, errors.New("Signature has no KeyInfo")
+	}
+	var certs []*x509.Certificate
+	for _, data := range keyInfo.childElements(dsigNamespace, "X509Data") {
+		for _, certNode := range data.childElements(dsigNamespace, "X509Certificate") {
+			der, err := decodeBase64(certNode)
+			if err != nil {
+				return nil, err
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("KeyInfo has no X509Certificate")
+	}
+	// The signer is the certificate that hasn't issued any of the others
+	signer := certs[0]
+	for _, cert := range certs {
+		if !issuesAny(cert, certs) {
+			signer = cert
+			break
+		}
+	}
+	chain := []*x509.Certificate{signer}
+	for cert := signer; ; {
+		parent := issuer(cert, certs)
+		if parent == nil {
+			break
+		}
+		if err := cert.CheckSignatureFrom(parent); err != nil {
+			return nil, errors.New("Certificate chain is broken: " + err.Error())
+		}
+		chain = append(chain, parent)
+		if len(chain) > len(certs) {
+			return nil, errors.New("Certificate chain has a loop")
+		}
+		cert = parent
+	}
+	root := chain[len(chain)-1]
+	switch {
+	case !bytes.Equal(root.RawIssuer, root.RawSubject):
+		return nil, errors.New("Certificate chain has no root: issuer " +
+			root.Issuer.String() + " is not in KeyInfo")
+	case len(chain) == 1:
+		return nil, errors.New("Signer certificate is self-signed")
+	}
+	if err := root.CheckSignatureFrom(root); err != nil {
+		return nil, errors.New("Root certificate is not self-signed: " + err.Error())
+	}
+	at := opts.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	for _, cert := range chain {
+		if at.Before(cert.NotBefore) || at.After(cert.NotAfter) {
+			return nil, fmt.Errorf("Certificate %s is only valid from %s to %s, not at %s",
+				cert.Subject, cert.NotBefore.Format(time.RFC3339),
+				cert.NotAfter.Format(time.RFC3339), at.Format(time.RFC3339))
+		}
+	}
+	if opts.Roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := chain[0].Verify(x509.VerifyOptions{
+			Roots:         opts.Roots,
+			Intermediates: intermediates,
+			CurrentTime:   at,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return nil, errors.New("Certificate chain is not trusted: " + err.Error())
+		}
+	}
+	return chain, nil
+}
+
+// issuer finds the certificate that issued cert; self-signed certificates
+// have no issuer
+func issuer(cert *x509.Certificate, certs []*x509.Certificate) *x509.Certificate {
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return nil
+	}
+	for _, c := range certs {
+		if c != cert && bytes.Equal(c.RawSubject, cert.RawIssuer) {
+			return c
+		}
+	}
+	return nil
+}
+
+// issuesAny checks if cert issued any of the other certificates
+func issuesAny(cert *x509.Certificate, certs []*x509.Certificate) bool {
+	for _, c := range certs {
+		if c != cert && issuer(c, certs) == cert {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeBase64 decodes the Base64 text of an element, ignoring whitespace
+func decodeBase64(n *node) ([]byte, error) {
+	if n == nil {
+		return nil, errors.New("Missing Base64 element")
+	}
+	text := strings.Join(strings.Fields(n.textContent()), "")
+	return base64.StdEncoding.DecodeString(text)
+}
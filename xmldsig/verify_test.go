@@ -0,0 +1,331 @@
+//
+//  Copyright 2015  Google Inc. All Rights Reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDocXML is a signed document template; the signature replaces SIG
+var testDocXML = `<?xml version="1.0" encoding="UTF-8"?>
+<CompositionPlaylist xmlns="http://www.smpte-ra.org/schemas/429-7/2006/CPL">
+  <Id>urn:uuid:d65572db-2e09-4745-817d-a2881222e2db</Id>
+  <!-- comments are not signed -->
+  <ContentTitleText>Signed</ContentTitleText>
+  SIG
+</CompositionPlaylist>`
+
+// makeCertificate creates an RSA certificate valid for the next hour,
+// issued by parent or self-signed if parent is nil
+func makeCertificate(t *testing.T, name string, serial int64, parent *x509.Certificate,
+	parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	return makeCertificateValid(t, name, serial, parent, parentKey,
+		time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+}
+
+// makeCertificateValid creates an RSA certificate valid between notBefore
+// and notAfter
+func makeCertificateValid(t *testing.T, name string, serial int64, parent *x509.Certificate,
+	parentKey *rsa.PrivateKey, notBefore, notAfter time.Time) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return cert, key
+}
+
+// sign signs a document template using inclusive c14n for the reference
+// and the given c14n and signature methods for SignedInfo
+func sign(t *testing.T, template, c14nMethod, sigMethod string, hash crypto.Hash,
+	key *rsa.PrivateKey, certs ...*x509.Certificate) string {
+	return signReferences(t, template, []string{""}, c14nMethod, sigMethod, hash, key, certs...)
+}
+
+// signReferences is sign with a reference to each of uris
+func signReferences(t *testing.T, template string, uris []string, c14nMethod, sigMethod string,
+	hash crypto.Hash, key *rsa.PrivateKey, certs ...*x509.Certificate) string {
+	unsigned, err := parseDocument([]byte(strings.Replace(template, "SIG", "", 1)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	var references string
+	for _, uri := range uris {
+		target := unsigned
+		if uri != "" {
+			target = findID(unsigned, uri[1:])
+		}
+		digest := sha256.Sum256((&canonicalizer{}).canonicalize(target))
+		references += `
+      <ds:Reference URI="` + uri + `">
+        <ds:Transforms>
+          <ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>
+        </ds:Transforms>
+        <ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>
+        <ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue>
+      </ds:Reference>`
+	}
+	var keyInfo string
+	for _, cert := range certs {
+		keyInfo += "<ds:X509Data><ds:X509Certificate>" +
+			base64.StdEncoding.EncodeToString(cert.Raw) + "</ds:X509Certificate></ds:X509Data>"
+	}
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+    <ds:SignedInfo>
+      <ds:CanonicalizationMethod Algorithm="` + c14nMethod + `"/>
+      <ds:SignatureMethod Algorithm="` + sigMethod + `"/>` + references + `
+    </ds:SignedInfo>
+    <ds:SignatureValue>VALUE</ds:SignatureValue>
+    <ds:KeyInfo>` + keyInfo + `</ds:KeyInfo>
+  </ds:Signature>`
+	doc := strings.Replace(template, "SIG", signature, 1)
+	root, err := parseDocument([]byte(doc))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	signedInfo := root.documentElement().child(dsigNamespace, "Signature").
+		child(dsigNamespace, "SignedInfo")
+	c, err := newCanonicalizer(signedInfo.child(dsigNamespace, "CanonicalizationMethod"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	h := hash.New()
+	h.Write(c.canonicalize(signedInfo))
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	// Wrap the value over several lines, as most signers do
+	encoded := base64.StdEncoding.EncodeToString(value)
+	return strings.Replace(doc, "VALUE", encoded[:40]+"\n"+encoded[40:], 1)
+}
+
+func TestVerify(t *testing.T) {
+	root, rootKey := makeCertificate(t, "root", 1, nil, nil)
+	leaf, leafKey := makeCertificate(t, "leaf", 2, root, rootKey)
+	methods := []struct {
+		c14n, sig string
+		hash      crypto.Hash
+	}{
+		{C14N, RSASHA256, crypto.SHA256},
+		{C14NWithComments, RSASHA256, crypto.SHA256},
+		{ExcC14N, RSASHA1, crypto.SHA1},
+	}
+	for _, m := range methods {
+		doc := sign(t, testDocXML, m.c14n, m.sig, m.hash, leafKey, root, leaf)
+		chain, err := Verify([]byte(doc), Options{})
+		if err != nil {
+			t.Errorf("Verify with %s and %s failed: %s", m.c14n, m.sig, err)
+			continue
+		}
+		if len(chain) != 2 || chain[0].Subject.CommonName != "leaf" ||
+			chain[1].Subject.CommonName != "root" {
+			t.Errorf("Certificate chain is incorrect: %v", chain)
+		}
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	root, rootKey := makeCertificate(t, "root", 1, nil, nil)
+	leaf, leafKey := makeCertificate(t, "leaf", 2, root, rootKey)
+	doc := sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256, leafKey, leaf, root)
+	// Comments aren't covered by the signature
+	if _, err := Verify([]byte(strings.Replace(doc, "are not signed", "changed", 1)), Options{}); err != nil {
+		t.Errorf("Changing a comment should not break the signature: %s", err)
+	}
+	tampered := strings.Replace(doc, ">Signed<", ">Tampered<", 1)
+	if _, err := Verify([]byte(tampered), Options{}); err == nil ||
+		!strings.Contains(err.Error(), "Digest") {
+		t.Errorf("Tampered content should fail the digest check: %v", err)
+	}
+	tampered = strings.Replace(doc, `URI=""`, `URI="" Id="x"`, 1)
+	if _, err := Verify([]byte(tampered), Options{}); err == nil ||
+		!strings.Contains(err.Error(), "Signature value") {
+		t.Errorf("Tampered SignedInfo should fail the signature check: %v", err)
+	}
+	// Signed with a key that doesn't match the certificate
+	other, otherKey := makeCertificate(t, "other", 3, nil, nil)
+	doc = sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256, otherKey, leaf, root)
+	if _, err := Verify([]byte(doc), Options{}); err == nil {
+		t.Errorf("Signature by %s should not verify with the leaf certificate",
+			other.Subject.CommonName)
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	doc := strings.Replace(testDocXML, "SIG", "", 1)
+	if _, err := Verify([]byte(doc), Options{}); err != ErrUnsigned {
+		t.Errorf("Unsigned document should return ErrUnsigned: %v", err)
+	}
+}
+
+func TestVerifyDocument(t *testing.T) {
+	root, rootKey := makeCertificate(t, "root", 1, nil, nil)
+	leaf, leafKey := makeCertificate(t, "leaf", 2, root, rootKey)
+	doc := sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256, leafKey, leaf, root)
+	if _, err := VerifyDocument([]byte(doc), Options{}); err != nil {
+		t.Errorf("Whole document signature should verify: %s", err)
+	}
+	// A reference to the document element by its Id covers the document
+	template := strings.Replace(testDocXML, "<CompositionPlaylist ", `<CompositionPlaylist Id="cpl" `, 1)
+	doc = signReferences(t, template, []string{"#cpl"}, C14N, RSASHA256, crypto.SHA256, leafKey, leaf, root)
+	if _, err := VerifyDocument([]byte(doc), Options{}); err != nil {
+		t.Errorf("Reference to the document element should verify: %s", err)
+	}
+	// Only the title is signed, so the rest of the document could change
+	template = strings.Replace(testDocXML, "<ContentTitleText>", `<ContentTitleText Id="title">`, 1)
+	doc = signReferences(t, template, []string{"#title"}, C14N, RSASHA256, crypto.SHA256, leafKey, leaf, root)
+	if _, err := Verify([]byte(doc), Options{}); err != nil {
+		t.Errorf("Reference to an element should verify: %s", err)
+	}
+	tampered := strings.Replace(doc, "urn:uuid:d65572db", "urn:uuid:00000000", 1)
+	if _, err := Verify([]byte(tampered), Options{}); err != nil {
+		t.Errorf("Content outside the reference is not signed: %s", err)
+	}
+	if _, err := VerifyDocument([]byte(tampered), Options{}); err == nil ||
+		!strings.Contains(err.Error(), "whole document") {
+		t.Errorf("Signature that doesn't cover the document should fail: %v", err)
+	}
+}
+
+// testKDMXML is KDM-shaped: its two parts are signed by their Ids
+const testKDMXML = `<DCinemaSecurityMessage xmlns="http://www.smpte-ra.org/schemas/430-3/2006/ETM">
+  <AuthenticatedPublic Id="ID_AuthenticatedPublic">
+    <MessageId>urn:uuid:1b6a3d2e-4c2f-4d6e-9a1c-0f2e3d4c5b6a</MessageId>
+  </AuthenticatedPublic>
+  <AuthenticatedPrivate Id="ID_AuthenticatedPrivate">
+    <EncryptedKey>a2V5</EncryptedKey>
+  </AuthenticatedPrivate>
+  SIG
+</DCinemaSecurityMessage>`
+
+func TestVerifyElements(t *testing.T) {
+	root, rootKey := makeCertificate(t, "root", 1, nil, nil)
+	leaf, leafKey := makeCertificate(t, "leaf", 2, root, rootKey)
+	parts := []string{"AuthenticatedPublic", "AuthenticatedPrivate"}
+	doc := signReferences(t, testKDMXML, []string{"#ID_AuthenticatedPublic", "#ID_AuthenticatedPrivate"},
+		C14N, RSASHA256, crypto.SHA256, leafKey, leaf, root)
+	if _, err := VerifyElements([]byte(doc), Options{}, parts...); err != nil {
+		t.Errorf("Signature of both parts should verify: %s", err)
+	}
+	// Only the public part is signed, so the keys could change
+	doc = signReferences(t, testKDMXML, []string{"#ID_AuthenticatedPublic"},
+		C14N, RSASHA256, crypto.SHA256, leafKey, leaf, root)
+	if _, err := Verify([]byte(doc), Options{}); err != nil {
+		t.Errorf("Reference to the public part should verify: %s", err)
+	}
+	if _, err := VerifyElements([]byte(doc), Options{}, parts...); err == nil ||
+		!strings.Contains(err.Error(), "AuthenticatedPrivate") {
+		t.Errorf("Signature without the private part should fail: %v", err)
+	}
+	// The whole document signed is not a reference to either part
+	doc = sign(t, testKDMXML, C14N, RSASHA256, crypto.SHA256, leafKey, leaf, root)
+	if _, err := VerifyElements([]byte(doc), Options{}, parts...); err == nil {
+		t.Errorf("Signature without references to the parts should fail")
+	}
+}
+
+func TestVerifyCertificates(t *testing.T) {
+	root, rootKey := makeCertificate(t, "root", 1, nil, nil)
+	leaf, leafKey := makeCertificate(t, "leaf", 2, root, rootKey)
+	// A self-made signer
+	if _, err := Verify([]byte(sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256,
+		rootKey, root)), Options{}); err == nil {
+		t.Errorf("Self-signed signer should not verify")
+	}
+	// The root that issued the signer is missing
+	if _, err := Verify([]byte(sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256,
+		leafKey, leaf)), Options{}); err == nil || !strings.Contains(err.Error(), "no root") {
+		t.Errorf("Chain without a root should not verify: %v", err)
+	}
+	// Expired and not yet valid certificates
+	past := time.Now().Add(-48 * time.Hour)
+	expired, expiredKey := makeCertificateValid(t, "expired", 3, root, rootKey,
+		past, past.Add(time.Hour))
+	if _, err := Verify([]byte(sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256,
+		expiredKey, expired, root)), Options{}); err == nil || !strings.Contains(err.Error(), "valid") {
+		t.Errorf("Expired signer should not verify: %v", err)
+	}
+	// Both were valid when the document was signed
+	oldRoot, oldRootKey := makeCertificateValid(t, "root", 6, nil, nil,
+		past.Add(-time.Hour), past.Add(2*time.Hour))
+	expired, expiredKey = makeCertificateValid(t, "expired", 7, oldRoot, oldRootKey,
+		past, past.Add(time.Hour))
+	if _, err := Verify([]byte(sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256,
+		expiredKey, expired, oldRoot)), Options{Time: past.Add(time.Minute)}); err != nil {
+		t.Errorf("Chain valid when the document was signed should verify: %s", err)
+	}
+	future := time.Now().Add(48 * time.Hour)
+	futureRoot, futureRootKey := makeCertificateValid(t, "future", 4, nil, nil,
+		future, future.Add(time.Hour))
+	futureLeaf, futureLeafKey := makeCertificate(t, "leaf", 5, futureRoot, futureRootKey)
+	if _, err := Verify([]byte(sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256,
+		futureLeafKey, futureLeaf, futureRoot)), Options{}); err == nil || !strings.Contains(err.Error(), "valid") {
+		t.Errorf("Root that isn't valid yet should not verify: %v", err)
+	}
+}
+
+func TestVerifyRoots(t *testing.T) {
+	root, rootKey := makeCertificate(t, "root", 1, nil, nil)
+	leaf, leafKey := makeCertificate(t, "leaf", 2, root, rootKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	doc := sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256, leafKey, leaf, root)
+	if _, err := Verify([]byte(doc), Options{Roots: roots}); err != nil {
+		t.Errorf("Chain to a trusted root should verify: %s", err)
+	}
+	// Anyone can make a chain of their own, which only passes the
+	// structural checks
+	otherRoot, otherRootKey := makeCertificate(t, "root", 1, nil, nil)
+	otherLeaf, otherLeafKey := makeCertificate(t, "leaf", 2, otherRoot, otherRootKey)
+	doc = sign(t, testDocXML, C14N, RSASHA256, crypto.SHA256, otherLeafKey, otherLeaf, otherRoot)
+	if _, err := Verify([]byte(doc), Options{}); err != nil {
+		t.Errorf("Chain should pass the structural checks: %s", err)
+	}
+	if _, err := Verify([]byte(doc), Options{Roots: roots}); err == nil ||
+		!strings.Contains(err.Error(), "not trusted") {
+		t.Errorf("Chain to an untrusted root should not verify: %v", err)
+	}
+}